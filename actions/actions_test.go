@@ -3,6 +3,7 @@ package actions
 import (
 	"testing"
 
+	"github.com/FANIoT/link/core"
 	"github.com/gobuffalo/suite"
 )
 
@@ -11,8 +12,11 @@ type ActionSuite struct {
 }
 
 func Test_ActionSuite(t *testing.T) {
+	a := core.New(core.NewMemorySink())
+	a.Run()
+
 	as := &ActionSuite{
-		suite.NewAction(App()),
+		suite.NewAction(App(a)),
 	}
 	suite.Run(t, as)
 }
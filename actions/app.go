@@ -1,16 +1,16 @@
 package actions
 
 import (
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/FANIoT/link/core"
+	mqtts "github.com/FANIoT/link/mqtt"
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/envy"
 	contenttype "github.com/gobuffalo/mw-contenttype"
 	paramlogger "github.com/gobuffalo/mw-paramlogger"
 
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/gobuffalo/x/sessions"
@@ -23,10 +23,18 @@ var ENV = envy.Get("GO_ENV", "development")
 var app *buffalo.App
 var coreApp *core.Application
 
+// http service rejects states that are ahead of link clock more than clockSkew
+var clockSkew time.Duration
+
+// administrator requests must have adminSecret in their Authorization header
+var adminSecret string
+
 // App is where all routes and middleware for buffalo
 // should be defined. This is the nerve center of your
 // application.
-func App() *buffalo.App {
+// core application is shared between all of the link services so it
+// is created and run by the caller.
+func App(a *core.Application) *buffalo.App {
 	if app == nil {
 		app = buffalo.New(buffalo.Options{
 			Env:          ENV,
@@ -42,77 +50,72 @@ func App() *buffalo.App {
 		// content type will be used.
 		app.Use(contenttype.Add("application/json"))
 
+		// request identification appears in responses and pipeline logs
+		app.Use(RequestID)
+
+		// commands are delivered to ttn devices with their downlink url when there is any ttn handler host.
+		// downlinks are sent on behalf of uplinks so they are not enabled with the default ttn secret.
+		for _, host := range strings.Split(envy.Get("TTN_DOWNLINK_HOSTS", ""), ",") {
+			if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+				ttnDownlink.hosts[host] = true
+			}
+		}
+		if ttnDownlink.enabled() {
+			if envy.Get("TTN_SECRET", defaultTTNSecret) == defaultTTNSecret {
+				app.Logger.Fatal("TTN downlinks cannot be enabled with the default TTN_SECRET")
+			}
+			// grifts create the app without any core application.
+			if a != nil {
+				a.RegisterDeliverer(ttnDownlink)
+			}
+		}
+
 		if ENV == "development" {
 			app.Use(paramlogger.ParameterLogger)
 		}
 
 		// core application provides a simple way for parse and store
 		// incoming data
-		coreApp = core.New()
-		coreApp.Run()
+		coreApp = a
+
+		skew, err := time.ParseDuration(envy.Get("HTTP_CLOCK_SKEW", "5m"))
+		if err != nil {
+			app.Logger.Fatalf("HTTP clock skew parse error: %s", err)
+		}
+		clockSkew = skew
+
+		// there is no default administrator secret so administrator routes are disabled without it
+		adminSecret = envy.Get("ADMIN_SECRET", "")
+		if adminSecret == "" {
+			app.Logger.Warn("ADMIN_SECRET is not set so administrator routes are disabled")
+		}
 
 		// prometheus collectors
-		rds := prometheus.NewHistogramVec(
-			prometheus.HistogramOpts{
-				Namespace: "link",
-				Name:      "request_duration_seconds",
-				Help:      "A histogram of latencies for requests.",
-			},
-			[]string{"path", "method", "code"},
-		)
-
-		rc := prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Namespace: "link",
-				Name:      "request_counter",
-				Help:      "How many HTTP requests processed",
-			},
-			[]string{"path", "method", "code"},
-		)
-
-		prometheus.NewGoCollector()
-		prometheus.MustRegister(rds)
-		prometheus.MustRegister(rc)
-
-		app.Use(func(next buffalo.Handler) buffalo.Handler {
-			return func(c buffalo.Context) error {
-				now := time.Now()
-
-				defer func() {
-					ws := c.Response().(*buffalo.Response)
-					req := c.Request()
-
-					rds.With(prometheus.Labels{
-						"path":   req.URL.String(),
-						"code":   strconv.Itoa(ws.Status),
-						"method": req.Method,
-					}).Observe(time.Since(now).Seconds())
-
-					rc.With(prometheus.Labels{
-						"path":   req.URL.String(),
-						"code":   strconv.Itoa(ws.Status),
-						"method": req.Method,
-					}).Inc()
-				}()
-
-				return next(c)
-			}
-		})
+		app.Use(Metrics)
 
 		// Routes
 		app.GET("/about", AboutHandler)
 		// mqtt service (authorization module)
 		mqtt := app.Group("/mqtt")
 		{
-			vmq := VernemqAuthPlugin{}
+			topics, err := mqtts.TopicsFromEnv()
+			if err != nil {
+				app.Logger.Fatalf("MQTT topics parse error: %s", err)
+			}
+			vmq := VernemqAuthPlugin{
+				Topics: topics,
+			}
 			mqtt.POST("/auth/publish", vmq.OnPublish)
 			mqtt.POST("/auth/subscribe", vmq.OnSubscribe)
+			mqtt.POST("/hook/subscribe", vmq.OnSubscribed)
 		}
 		// http service
 		http := app.Group("/http")
 		{
 			http.Use(HTTPAuthorize)
 			http.POST("/push/{thing_id}", HTTPHandler)
+			http.GET("/commands/{thing_id}", HTTPCommandsHandler)
+			http.POST("/commands/{thing_id}/{command_id}/ack", HTTPCommandAckHandler)
 		}
 		// ttn integration module
 		ttn := app.Group("/ttn")
@@ -120,6 +123,55 @@ func App() *buffalo.App {
 			ttn.Use(TTNAuthorize)
 			ttn.POST("/{project_id}", TTNHandler)
 		}
+		// commands, shadows and states of things
+		things := app.Group("/things")
+		{
+			things.Use(AdminAuthorize)
+			things.POST("/{thing_id}/commands", CommandHandler)
+			things.GET("/{thing_id}/commands", CommandsHandler)
+			things.GET("/{thing_id}/commands/{command_id}", CommandStatusHandler)
+			things.GET("/{thing_id}/shadow", ShadowHandler)
+			things.PATCH("/{thing_id}/shadow", ShadowPatchHandler)
+			things.GET("/{thing_id}/state", StateHandler)
+			things.GET("/{thing_id}/assets/{asset}/state", AssetStateHandler)
+		}
+		// stored states of things that are authorized by their tokens
+		projects := app.Group("/projects")
+		{
+			projects.Use(HTTPAuthorize)
+			projects.GET("/{project_id}/things/{thing_id}/assets/{asset}/states", HistoryHandler)
+			projects.GET("/{project_id}/things/{thing_id}/assets/{asset}/aggregates", AggregateHandler)
+		}
+		// retention policies of projects
+		retentions := app.Group("/retentions")
+		{
+			retentions.Use(AdminAuthorize)
+			retentions.GET("/{project_id}", RetentionHandler)
+			retentions.PUT("/{project_id}", RetentionPutHandler)
+			retentions.DELETE("/{project_id}", RetentionDeleteHandler)
+		}
+		// rules and alerts of projects
+		rules := app.Group("/rules")
+		{
+			rules.Use(AdminAuthorize)
+			rules.GET("/{project_id}", RulesHandler)
+			rules.POST("/{project_id}", RuleCreateHandler)
+			rules.GET("/{project_id}/{rule_id}", RuleHandler)
+			rules.PUT("/{project_id}/{rule_id}", RuleUpdateHandler)
+			rules.DELETE("/{project_id}/{rule_id}", RuleDeleteHandler)
+		}
+		alerts := app.Group("/alerts")
+		{
+			alerts.Use(AdminAuthorize)
+			alerts.GET("/{project_id}", AlertsHandler)
+		}
+		// dead letters of pipeline
+		deadletters := app.Group("/deadletters")
+		{
+			deadletters.Use(AdminAuthorize)
+			deadletters.GET("/", DeadLettersHandler)
+			deadletters.POST("/{deadletter_id}/reinject", DeadLetterReinjectHandler)
+		}
 		app.GET("/metrics", buffalo.WrapHandler(promhttp.Handler()))
 	}
 
@@ -0,0 +1,100 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     command.go
+ * +===============================================
+ */
+
+package actions
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/FANIoT/link/core"
+	"github.com/gobuffalo/buffalo"
+)
+
+// limitParam returns limit query parameter or given default limit
+func limitParam(c buffalo.Context, def int) (int, error) {
+	l := c.Param("limit")
+	if l == "" {
+		return def, nil
+	}
+	return strconv.Atoi(l)
+}
+
+// CommandHandler sends a command to the thing
+// This function is mapped to the path POST /things/{thing_id}/commands
+func CommandHandler(c buffalo.Context) error {
+	var rq core.CommandRequest
+	if err := c.Bind(&rq); err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	cmd, err := coreApp.Command(c, c.Param("thing_id"), rq)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	return c.Render(http.StatusCreated, r.JSON(cmd))
+}
+
+// CommandsHandler lists the oldest commands of the thing
+// This function is mapped to the path GET /things/{thing_id}/commands?limit={limit}
+func CommandsHandler(c buffalo.Context) error {
+	limit, err := limitParam(c, 100)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	cs, err := coreApp.Commands(c, c.Param("thing_id"), limit)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(cs))
+}
+
+// CommandStatusHandler returns a command of the thing with its status
+// This function is mapped to the path GET /things/{thing_id}/commands/{command_id}
+func CommandStatusHandler(c buffalo.Context) error {
+	cmd, err := coreApp.CommandByID(c, c.Param("thing_id"), c.Param("command_id"))
+	if err != nil {
+		return c.Error(http.StatusNotFound, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(cmd))
+}
+
+// HTTPCommandsHandler returns queued commands of the thing so devices can poll their commands
+// This function is mapped to the path GET /http/commands/{thing_id}?limit={limit}
+func HTTPCommandsHandler(c buffalo.Context) error {
+	limit, err := limitParam(c, 10)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	cs, err := coreApp.PollCommands(c, c.Value("thing_id").(string), limit)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(cs))
+}
+
+// HTTPCommandAckHandler acknowledges a command of the thing
+// This function is mapped to the path POST /http/commands/{thing_id}/{command_id}/ack
+func HTTPCommandAckHandler(c buffalo.Context) error {
+	if err := coreApp.AckCommand(c, c.Value("thing_id").(string), c.Param("command_id")); err != nil {
+		return c.Error(http.StatusNotFound, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(true))
+}
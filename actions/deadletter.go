@@ -0,0 +1,65 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     deadletter.go
+ * +===============================================
+ */
+
+package actions
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// AdminAuthorize checks Authorization header to find out is it an administrator request
+// Please consider that this function is a miidleware
+// administrator routes are disabled when ADMIN_SECRET is not set.
+func AdminAuthorize(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		if adminSecret == "" {
+			return c.Error(http.StatusForbidden, fmt.Errorf("administrator routes are disabled because ADMIN_SECRET is not set"))
+		}
+
+		authString := c.Request().Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(authString), []byte(adminSecret)) != 1 {
+			return c.Error(http.StatusUnauthorized, fmt.Errorf("unathorized access token"))
+		}
+		return next(c)
+	}
+}
+
+// DeadLettersHandler lists the oldest dead letters of pipeline
+// This function is mapped to the path GET /deadletters?limit={limit}
+func DeadLettersHandler(c buffalo.Context) error {
+	limit, err := limitParam(c, 100)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	ls, err := coreApp.DeadLetters(c, limit)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(ls))
+}
+
+// DeadLetterReinjectHandler passes a dead letter into pipeline again
+// This function is mapped to the path POST /deadletters/{deadletter_id}/reinject
+func DeadLetterReinjectHandler(c buffalo.Context) error {
+	if err := coreApp.Reinject(c, c.Param("deadletter_id")); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(true))
+}
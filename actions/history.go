@@ -0,0 +1,225 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     history.go
+ * +===============================================
+ */
+
+package actions
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FANIoT/link/core"
+	"github.com/FANIoT/link/senml"
+	"github.com/FANIoT/types"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/ugorji/go/codec"
+)
+
+// maxHistoryLimit is the maximum number of states in each history page
+const maxHistoryLimit = 1000
+
+// content types of history responses
+const (
+	cborContentType = "application/cbor"
+	csvContentType  = "text/csv"
+)
+
+// timeParam parses given query parameter as unix seconds or RFC3339 time.
+// empty parameter is zero time.
+func timeParam(c buffalo.Context, name string) (time.Time, error) {
+	v := c.Param(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	if s, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(s, 0), nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s time %s", name, v)
+	}
+	return t, nil
+}
+
+// projectParam checks that project of the thing is the requested project
+func projectParam(c buffalo.Context) error {
+	if c.Param("project_id") != c.Value("project_id").(string) {
+		return fmt.Errorf("thing %s is not in project %s", c.Param("thing_id"), c.Param("project_id"))
+	}
+	return nil
+}
+
+// HistoryHandler returns stored states of the thing asset page by page.
+// responses are json, cbor, csv or senml based on the request accept header and
+// the cursor of the next page is in the X-Next-Cursor header too.
+// senml responses have no units because units are not kept on ingest.
+// This function is mapped to the path
+// GET /projects/{project_id}/things/{thing_id}/assets/{asset}/states?from={from}&to={to}&limit={limit}&cursor={cursor}
+func HistoryHandler(c buffalo.Context) error {
+	if err := projectParam(c); err != nil {
+		return c.Error(http.StatusNotFound, err)
+	}
+
+	from, err := timeParam(c, "from")
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+	to, err := timeParam(c, "to")
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+	limit, err := limitParam(c, 100)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+	if limit <= 0 || limit > maxHistoryLimit {
+		return c.Error(http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxHistoryLimit))
+	}
+
+	p, err := coreApp.History(c, c.Value("project_id").(string), c.Value("thing_id").(string), c.Param("asset"), from, to, limit, c.Param("cursor"))
+	if err != nil {
+		if err == core.ErrNoQuerier {
+			return c.Error(http.StatusNotImplemented, err)
+		}
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	if p.Cursor != "" {
+		c.Response().Header().Set("X-Next-Cursor", p.Cursor)
+	}
+
+	accept := c.Request().Header.Get("Accept")
+	if rr, ok := senmlRenderer(accept, p.States); ok {
+		return c.Render(http.StatusOK, rr)
+	}
+	switch {
+	case strings.Contains(accept, cborContentType):
+		return c.Render(http.StatusOK, r.Func(cborContentType, func(w io.Writer, _ render.Data) error {
+			return codec.NewEncoder(w, new(codec.CborHandle)).Encode(p)
+		}))
+	case strings.Contains(accept, csvContentType):
+		return c.Render(http.StatusOK, r.Func(csvContentType, func(w io.Writer, _ render.Data) error {
+			return writeCSV(w, p.States)
+		}))
+	default:
+		return c.Render(http.StatusOK, r.JSON(p))
+	}
+}
+
+// AggregateHandler returns min, max, mean, count and last of the thing asset numeric states
+// in each time bucket. buckets are 1m, 1h or 1d.
+// This function is mapped to the path
+// GET /projects/{project_id}/things/{thing_id}/assets/{asset}/aggregates?bucket={bucket}&from={from}&to={to}
+func AggregateHandler(c buffalo.Context) error {
+	if err := projectParam(c); err != nil {
+		return c.Error(http.StatusNotFound, err)
+	}
+
+	bucket, ok := core.Buckets[c.Param("bucket")]
+	if !ok {
+		return c.Error(http.StatusBadRequest, fmt.Errorf("bucket %s is not supported", c.Param("bucket")))
+	}
+	from, err := timeParam(c, "from")
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+	to, err := timeParam(c, "to")
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	bs, err := coreApp.Aggregate(c, c.Value("project_id").(string), c.Value("thing_id").(string), c.Param("asset"), from, to, bucket)
+	if err != nil {
+		if err == core.ErrNoQuerier {
+			return c.Error(http.StatusNotImplemented, err)
+		}
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(bs))
+}
+
+// senmlRenderer renders states as a senml pack when the accept header asks for senml json or cbor
+func senmlRenderer(accept string, ss []types.State) (render.Renderer, bool) {
+	var encode func(senml.Pack) ([]byte, error)
+	var contentType string
+	switch {
+	case strings.Contains(accept, senml.JSONContentType):
+		encode, contentType = senml.EncodeJSON, senml.JSONContentType
+	case strings.Contains(accept, senml.CBORContentType):
+		encode, contentType = senml.EncodeCBOR, senml.CBORContentType
+	default:
+		return nil, false
+	}
+
+	return r.Func(contentType, func(w io.Writer, _ render.Data) error {
+		b, err := encode(senml.FromStates(ss))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}), true
+}
+
+// writeCSV writes states as csv records with a header. arrays and objects are json encoded.
+func writeCSV(w io.Writer, ss []types.State) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"at", "project", "thingid", "asset", "number", "string", "boolean", "array", "object"}); err != nil {
+		return err
+	}
+
+	for _, s := range ss {
+		var array, object string
+		if s.Value.Array != nil {
+			b, err := json.Marshal(s.Value.Array)
+			if err != nil {
+				return err
+			}
+			array = string(b)
+		}
+		if s.Value.Object != nil {
+			b, err := json.Marshal(s.Value.Object)
+			if err != nil {
+				return err
+			}
+			object = string(b)
+		}
+
+		if err := cw.Write([]string{
+			s.At.Format(time.RFC3339Nano),
+			s.Project,
+			s.ThingID,
+			s.Asset,
+			strconv.FormatFloat(s.Value.Number, 'g', -1, 64),
+			s.Value.String,
+			strconv.FormatBool(s.Value.Boolean),
+			array,
+			object,
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
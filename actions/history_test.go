@@ -0,0 +1,39 @@
+package actions
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/FANIoT/link/senml"
+	"github.com/FANIoT/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSenMLRenderer(t *testing.T) {
+	var s types.State
+	s.ThingID = "0"
+	s.Asset = "temperature"
+	s.At = time.Unix(1539858000, 0)
+	s.Raw = 18.20
+	s.Value.Number = 18.20
+
+	_, ok := senmlRenderer("application/json", []types.State{s})
+	assert.False(t, ok)
+
+	rr, ok := senmlRenderer(senml.JSONContentType, []types.State{s})
+	assert.True(t, ok)
+	assert.Equal(t, senml.JSONContentType, rr.ContentType())
+	var b bytes.Buffer
+	assert.NoError(t, rr.Render(&b, nil))
+	assert.JSONEq(t, `[{"bn": "0:", "n": "temperature", "t": 1539858000, "v": 18.20}]`, b.String())
+
+	rr, ok = senmlRenderer(senml.CBORContentType+", application/json", []types.State{s})
+	assert.True(t, ok)
+	assert.Equal(t, senml.CBORContentType, rr.ContentType())
+	b.Reset()
+	assert.NoError(t, rr.Render(&b, nil))
+	p, err := senml.DecodeCBOR(b.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, senml.FromStates([]types.State{s}), p)
+}
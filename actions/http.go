@@ -14,11 +14,16 @@
 package actions
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"sort"
 	"time"
 
+	"github.com/FANIoT/link/core"
 	"github.com/FANIoT/link/pm"
+	"github.com/FANIoT/link/senml"
 	"github.com/FANIoT/types"
 	"github.com/gobuffalo/buffalo"
 	"github.com/sirupsen/logrus"
@@ -52,8 +57,107 @@ func HTTPAuthorize(next buffalo.Handler) buffalo.Handler {
 	}
 }
 
+// PushResponse reports acceptance of each record and asset of state request.
+// error is set when request payload is malformed so none of its records are accepted
+// or when pipeline cannot accept records so the records that are not reported must be sent again.
+type PushResponse struct {
+	RequestID string `json:"request_id"`
+	Error     string `json:"error,omitempty"`
+
+	Accepted int            `json:"accepted"`
+	Rejected int            `json:"rejected"`
+	Records  []RecordResult `json:"records"`
+
+	// assets with at least one accepted record and assets with at least
+	// one rejected record with the reason of their first rejection
+	AcceptedAssets []string          `json:"accepted_assets"`
+	RejectedAssets map[string]string `json:"rejected_assets"`
+}
+
+// newPushResponse creates an empty response for the request
+func newPushResponse(c buffalo.Context) *PushResponse {
+	id, _ := c.Value("request_id").(string)
+	return &PushResponse{
+		RequestID:      id,
+		Records:        make([]RecordResult, 0),
+		AcceptedAssets: make([]string, 0),
+		RejectedAssets: make(map[string]string),
+	}
+}
+
+// RecordResult is acceptance of a record, index is the record position in its asset readings
+type RecordResult struct {
+	Asset    string    `json:"asset"`
+	Index    int       `json:"index"`
+	At       time.Time `json:"at"`
+	Accepted bool      `json:"accepted"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// reading is a timestamped value of an asset in state requests
+type reading struct {
+	Index int
+	At    time.Time
+	Value interface{}
+	Err   error
+}
+
+// readings converts value of an asset into its readings. value is an array of timestamped readings
+// e.g. [{"at": "2018-10-18T10:20:00Z", "value": 18.20}] or any other value that is read now.
+func readings(value interface{}, now time.Time) []reading {
+	vs, ok := value.([]interface{})
+	if !ok || len(vs) == 0 {
+		return []reading{{At: now, Value: value}}
+	}
+
+	rs := make([]reading, 0, len(vs))
+	for i, v := range vs {
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			// it is an array value
+			return []reading{{At: now, Value: value}}
+		}
+		rv, ok := m["value"]
+		if !ok {
+			return []reading{{At: now, Value: value}}
+		}
+
+		at, err := readingTime(m["at"], now)
+		rs = append(rs, reading{
+			Index: i,
+			At:    at,
+			Value: rv,
+			Err:   err,
+		})
+	}
+
+	return rs
+}
+
+// readingTime converts time of a reading, it can be a timestamp, unix time in seconds or rfc3339 string.
+// readings without time are read now.
+func readingTime(v interface{}, now time.Time) (time.Time, error) {
+	switch t := v.(type) {
+	case nil:
+		return now, nil
+	case time.Time:
+		return t, nil
+	case int64:
+		return time.Unix(t, 0), nil
+	case uint64:
+		return time.Unix(int64(t), 0), nil
+	case float64:
+		return time.Unix(0, int64(t*float64(time.Second))), nil
+	case string:
+		return time.Parse(time.RFC3339Nano, t)
+	default:
+		return time.Time{}, fmt.Errorf("invalid time %v", v)
+	}
+}
+
 // HTTPHandler handles state request that are coming from devices.
-// it passes them into link pipeline.
+// it passes them into link pipeline. each asset has a value or an array of timestamped readings
+// and readings that are ahead of link clock more than clock skew window are rejected.
 func HTTPHandler(c buffalo.Context) error {
 	thingID := c.Value("thing_id").(string)
 	projectID := c.Value("project_id").(string)
@@ -61,34 +165,167 @@ func HTTPHandler(c buffalo.Context) error {
 	var h codec.Handle
 	ct := c.Request().Header.Get("Content-Type")
 	switch ct {
+	case senml.JSONContentType, senml.CBORContentType:
+		return senmlHandler(c, ct, thingID, projectID)
 	case "application/json":
 		h = new(codec.JsonHandle)
 	case "application/cbor":
 		h = new(codec.CborHandle)
 	default:
-		return c.Error(http.StatusBadRequest, fmt.Errorf("unsupported content type"))
+		rsp := newPushResponse(c)
+		rsp.Error = fmt.Sprintf("unsupported content type %s", ct)
+		return c.Render(http.StatusUnsupportedMediaType, r.JSON(rsp))
 	}
 
 	states := make(map[interface{}]interface{})
 
 	if err := codec.NewDecoder(c.Request().Body, h).Decode(&states); err != nil {
 		coreApp.Logger.WithFields(logrus.Fields{
-			"component": "http service",
+			"component":  "http service",
+			"request_id": c.Value("request_id"),
 		}).Errorf("Incoming data from %s with pid: %s is not a valid %s: %s", thingID, projectID, h.Name(), err)
 
-		return c.Render(http.StatusOK, r.JSON(true))
+		rsp := newPushResponse(c)
+		rsp.Error = fmt.Sprintf("payload is not a valid %s: %s", h.Name(), err)
+		return c.Render(http.StatusBadRequest, r.JSON(rsp))
 	}
 
+	// assets are sorted so response has a stable order
+	names := make([]string, 0, len(states))
+	values := make(map[string]interface{}, len(states))
 	for name, value := range states {
-		state := types.State{
-			Raw:     value,
-			At:      time.Now(),
-			ThingID: thingID,
-			Project: projectID,
-			Asset:   fmt.Sprintf("%v", name), // convert anything to string (is there any better way?)
+		n := fmt.Sprintf("%v", name) // convert anything to string (is there any better way?)
+		names = append(names, n)
+		values[n] = value
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	rsp := newPushResponse(c)
+	for _, name := range names {
+		for _, rd := range readings(values[name], now) {
+			state := types.State{
+				Raw:     rd.Value,
+				At:      rd.At,
+				ThingID: thingID,
+				Project: projectID,
+				Asset:   name,
+			}
+
+			rr, err := push(c, state, rd.Err, now)
+			if err != nil {
+				return interrupted(c, rsp, err)
+			}
+			rr.Index = rd.Index
+			rsp.add(rr)
+		}
+	}
+
+	return c.Render(http.StatusOK, r.JSON(rsp))
+}
+
+// senmlHandler handles SenML state requests that have their time and asset in each record
+func senmlHandler(c buffalo.Context, contentType string, thingID string, projectID string) error {
+	rsp := newPushResponse(c)
+
+	b, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	p, err := senml.Decode(b, contentType)
+	if err != nil {
+		rsp.Error = fmt.Sprintf("payload is not a valid senml: %s", err)
+		return c.Render(http.StatusBadRequest, r.JSON(rsp))
+	}
+
+	now := time.Now()
+	states, err := p.States(thingID, projectID, now)
+	if err != nil {
+		rsp.Error = fmt.Sprintf("payload is not a valid senml: %s", err)
+		return c.Render(http.StatusBadRequest, r.JSON(rsp))
+	}
+
+	for i, state := range states {
+		rr, err := push(c, state, nil, now)
+		if err != nil {
+			return interrupted(c, rsp, err)
+		}
+		rr.Index = i
+		rsp.add(rr)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(rsp))
+}
+
+// push validates given state and passes it into link pipeline. it returns an error
+// when pipeline cannot accept states so request must be failed.
+func push(c buffalo.Context, state types.State, err error, now time.Time) (RecordResult, error) {
+	rr := RecordResult{
+		Asset: state.Asset,
+		At:    state.At,
+	}
+
+	if err == nil && state.At.After(now.Add(clockSkew)) {
+		err = fmt.Errorf("time is ahead of link clock more than %s", clockSkew)
+	}
+	if err == nil {
+		err = coreApp.DataContext(requestContext(c), state)
+		if err != nil && dataErrorStatus(err) != http.StatusBadRequest {
+			return rr, err
 		}
-		coreApp.Data(state)
 	}
 
-	return c.Render(http.StatusOK, r.JSON(true))
+	if err != nil {
+		rr.Reason = err.Error()
+	} else {
+		rr.Accepted = true
+	}
+	return rr, nil
+}
+
+// interrupted renders response of the records that are pushed before the pipeline error
+// so clients only send the remaining records again.
+func interrupted(c buffalo.Context, rsp *PushResponse, err error) error {
+	rsp.Error = err.Error()
+	return c.Render(dataErrorStatus(err), r.JSON(rsp))
+}
+
+// add adds result of a record into response
+func (rsp *PushResponse) add(rr RecordResult) {
+	if rr.Accepted {
+		rsp.Accepted++
+
+		found := false
+		for _, a := range rsp.AcceptedAssets {
+			if a == rr.Asset {
+				found = true
+				break
+			}
+		}
+		if !found {
+			rsp.AcceptedAssets = append(rsp.AcceptedAssets, rr.Asset)
+		}
+	} else {
+		rsp.Rejected++
+
+		if _, ok := rsp.RejectedAssets[rr.Asset]; !ok {
+			rsp.RejectedAssets[rr.Asset] = rr.Reason
+		}
+	}
+	rsp.Records = append(rsp.Records, rr)
+}
+
+// dataErrorStatus returns http status code of core application data error.
+// full pipeline queue means that client must slow down and the others
+// mean that service is not available at this time.
+func dataErrorStatus(err error) int {
+	switch err {
+	case core.ErrQueueFull:
+		return http.StatusTooManyRequests
+	case core.ErrNotRunning, context.Canceled, context.DeadlineExceeded:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
 }
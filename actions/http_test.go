@@ -0,0 +1,56 @@
+package actions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
+)
+
+func TestReadings(t *testing.T) {
+	now := time.Now()
+
+	states := make(map[interface{}]interface{})
+	assert.NoError(t, codec.NewDecoderBytes([]byte(`{
+		"temperature": [{"at": "2018-10-18T10:20:00Z", "value": 18.20}, {"at": 1539858060, "value": 18.21}, {"at": true, "value": 18.22}],
+		"light": "on",
+		"position": [1, 2]
+	}`), new(codec.JsonHandle)).Decode(&states))
+
+	rs := readings(states["temperature"], now)
+	assert.Len(t, rs, 3)
+	assert.Equal(t, 18.20, rs[0].Value)
+	assert.Equal(t, time.Date(2018, 10, 18, 10, 20, 0, 0, time.UTC), rs[0].At.UTC())
+	assert.Equal(t, time.Unix(1539858060, 0), rs[1].At)
+	assert.Equal(t, 2, rs[2].Index)
+	assert.Error(t, rs[2].Err)
+
+	rs = readings(states["light"], now)
+	assert.Len(t, rs, 1)
+	assert.Equal(t, "on", rs[0].Value)
+	assert.Equal(t, now, rs[0].At)
+
+	rs = readings(states["position"], now)
+	assert.Len(t, rs, 1)
+	assert.Equal(t, now, rs[0].At)
+}
+
+func TestPushResponse(t *testing.T) {
+	rsp := &PushResponse{
+		Records:        make([]RecordResult, 0),
+		AcceptedAssets: make([]string, 0),
+		RejectedAssets: make(map[string]string),
+	}
+
+	rsp.add(RecordResult{Asset: "temperature", Accepted: true})
+	rsp.add(RecordResult{Asset: "temperature", Accepted: true})
+	rsp.add(RecordResult{Asset: "temperature", Reason: "18.20"})
+	rsp.add(RecordResult{Asset: "light", Reason: "18.21"})
+
+	assert.Equal(t, 2, rsp.Accepted)
+	assert.Equal(t, 2, rsp.Rejected)
+	assert.Equal(t, []string{"temperature"}, rsp.AcceptedAssets)
+	assert.Equal(t, map[string]string{"temperature": "18.20", "light": "18.21"}, rsp.RejectedAssets)
+	assert.Len(t, rsp.Records, 4)
+}
@@ -0,0 +1,99 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     metrics.go
+ * +===============================================
+ */
+
+package actions
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// http prometheus collectors, requests are labeled by their route pattern (e.g. /http/push/{thing_id}/)
+// and not their url so there is a limited number of series.
+var (
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "link",
+			Name:      "request_duration_seconds",
+			Help:      "A histogram of latencies for requests.",
+		},
+		[]string{"path", "method", "code"},
+	)
+
+	requestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "link",
+			Name:      "request_counter",
+			Help:      "How many HTTP requests processed",
+		},
+		[]string{"path", "method", "code"},
+	)
+
+	responseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "link",
+			Name:      "response_size_bytes",
+			Help:      "A histogram of response sizes for requests.",
+			Buckets:   prometheus.ExponentialBuckets(64, 4, 8),
+		},
+		[]string{"path", "method", "code"},
+	)
+
+	inFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "link",
+			Name:      "requests_in_flight",
+			Help:      "How many HTTP requests are being processed",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(requestDuration, requestCounter, responseSize, inFlight)
+}
+
+// routePath returns route pattern of the current request
+func routePath(c buffalo.Context) string {
+	if ri, ok := c.Value("current_route").(buffalo.RouteInfo); ok {
+		return ri.Path
+	}
+	return "unknown"
+}
+
+// Metrics is a middleware that observes each request on prometheus collectors
+func Metrics(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		now := time.Now()
+
+		inFlight.Inc()
+		defer func() {
+			inFlight.Dec()
+
+			ws := c.Response().(*buffalo.Response)
+			labels := prometheus.Labels{
+				"path":   routePath(c),
+				"code":   strconv.Itoa(ws.Status),
+				"method": c.Request().Method,
+			}
+
+			requestDuration.With(labels).Observe(time.Since(now).Seconds())
+			requestCounter.With(labels).Inc()
+			responseSize.With(labels).Observe(float64(ws.Size))
+		}()
+
+		return next(c)
+	}
+}
@@ -14,19 +14,26 @@
 package actions
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
 
+	mqtts "github.com/FANIoT/link/mqtt"
 	"github.com/FANIoT/link/pm"
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/envy"
+	"github.com/sirupsen/logrus"
 )
 
 // VernemqAuthPlugin is an authentication plugin based vernemq webhooks
 // see https://vernemq.com/docs/plugindevelopment/webhookplugins.html for more details
 // This plugin validate things and their tokens.
-type VernemqAuthPlugin struct{}
+// thing and its project are found in topics based on link mqtt topic templates
+// and topics that do not match them must have thing identification on their second level.
+type VernemqAuthPlugin struct {
+	Topics []*mqtts.Topic
+}
 
 // VernemqRequest is a minimal request structure for its webhook request data
 type VernemqRequest struct {
@@ -61,6 +68,48 @@ var (
 	}
 )
 
+// authorize checks that given token belongs to the thing of given topic
+func (v VernemqAuthPlugin) authorize(c buffalo.Context, topic string, token string) (bool, error) {
+	var thingID, project string
+	if _, vars, ok := mqtts.MatchTopics(v.Topics, topic); ok {
+		thingID = vars[mqtts.ThingIDVar]
+		project = vars[mqtts.ProjectVar]
+	} else {
+		levels := strings.Split(topic, "/")
+		if len(levels) < 2 {
+			return false, nil
+		}
+		thingID = levels[1]
+	}
+
+	t, err := pm.ThingByID(c, thingID)
+	if err != nil {
+		return false, err
+	}
+
+	if project != "" && project != t.Project {
+		return false, nil
+	}
+
+	for _, tk := range t.Tokens {
+		if tk == token {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// commandsTopic returns thing identification of the following commands topic
+// things/{thing_id}/commands/+
+func commandsTopic(topic string) (string, bool) {
+	levels := strings.Split(topic, "/")
+	if len(levels) != 4 || levels[0] != "things" || levels[2] != "commands" {
+		return "", false
+	}
+	return levels[1], true
+}
+
 // OnRegister is called when a new client connects to vernemq.
 // It is better to authorize clients when they try to subscribe and publish
 // data so this function always returns ok
@@ -69,7 +118,7 @@ func (VernemqAuthPlugin) OnRegister(c buffalo.Context) error {
 }
 
 // OnSubscribe is called when a client tries to subscribe on a topic
-func (VernemqAuthPlugin) OnSubscribe(c buffalo.Context) error {
+func (v VernemqAuthPlugin) OnSubscribe(c buffalo.Context) error {
 	var req VernemqRequest
 	if err := c.Bind(&req); err != nil {
 		return c.Error(http.StatusBadRequest, err)
@@ -86,25 +135,58 @@ func (VernemqAuthPlugin) OnSubscribe(c buffalo.Context) error {
 		return c.Render(http.StatusOK, r.JSON(VernemqErrorResponse))
 	}
 
-	thingID := strings.Split(req.Topics[0].Topic, "/")[1]
-
-	t, err := pm.ThingByID(c, thingID)
+	ok, err := v.authorize(c, req.Topics[0].Topic, req.Username)
 	if err != nil {
 		return c.Error(http.StatusInternalServerError, err)
 	}
+	if ok {
+		c.Response().Header().Add("cache-control", fmt.Sprintf("max-age=%d", 3600))
+		return c.Render(http.StatusOK, r.JSON(VernemqOKResponse))
+	}
+
+	return c.Render(http.StatusOK, r.JSON(VernemqErrorResponse))
+}
 
-	for _, token := range t.Tokens {
-		if token == req.Username {
-			c.Response().Header().Add("cache-control", fmt.Sprintf("max-age=%d", 3600))
-			return c.Render(http.StatusOK, r.JSON(VernemqOKResponse))
+// OnSubscribed is called when vernemq has activated the subscriptions of a client.
+// things subscribe on their commands topic after each connection so their undelivered commands
+// and shadow delta are pushed on it. it is called after the subscription so the thing receives them.
+func (VernemqAuthPlugin) OnSubscribed(c buffalo.Context) error {
+	var req VernemqRequest
+	if err := c.Bind(&req); err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	if req.Mountpoint == "i1820" || req.Username == envy.Get("USR_BROKER_USER", "ella") {
+		return c.Render(http.StatusOK, r.JSON(VernemqOKResponse))
+	}
+
+	for _, t := range req.Topics {
+		thingID, ok := commandsTopic(t.Topic)
+		if !ok {
+			continue
 		}
+
+		go func() {
+			if err := coreApp.Redeliver(context.Background(), thingID); err != nil {
+				coreApp.Logger.WithFields(logrus.Fields{
+					"component": "vernemq",
+					"thingid":   thingID,
+				}).Errorf("Command redelivery error: %s", err)
+			}
+			if err := coreApp.SyncShadow(context.Background(), thingID); err != nil {
+				coreApp.Logger.WithFields(logrus.Fields{
+					"component": "vernemq",
+					"thingid":   thingID,
+				}).Errorf("Shadow sync error: %s", err)
+			}
+		}()
 	}
 
-	return c.Render(http.StatusOK, r.JSON(VernemqErrorResponse))
+	return c.Render(http.StatusOK, r.JSON(VernemqOKResponse))
 }
 
 // OnPublish is called when a client tries to publish data on a topic
-func (VernemqAuthPlugin) OnPublish(c buffalo.Context) error {
+func (v VernemqAuthPlugin) OnPublish(c buffalo.Context) error {
 	var req VernemqRequest
 	if err := c.Bind(&req); err != nil {
 		return c.Error(http.StatusBadRequest, err)
@@ -116,18 +198,13 @@ func (VernemqAuthPlugin) OnPublish(c buffalo.Context) error {
 		return c.Render(http.StatusOK, r.JSON(VernemqOKResponse))
 	}
 
-	thingID := strings.Split(req.Topic, "/")[1]
-
-	t, err := pm.ThingByID(c, thingID)
+	ok, err := v.authorize(c, req.Topic, req.Username)
 	if err != nil {
 		return c.Error(http.StatusInternalServerError, err)
 	}
-
-	for _, token := range t.Tokens {
-		if token == req.Username {
-			c.Response().Header().Add("cache-control", fmt.Sprintf("max-age=%d", 3600))
-			return c.Render(http.StatusOK, r.JSON(VernemqOKResponse))
-		}
+	if ok {
+		c.Response().Header().Add("cache-control", fmt.Sprintf("max-age=%d", 3600))
+		return c.Render(http.StatusOK, r.JSON(VernemqOKResponse))
 	}
 
 	return c.Render(http.StatusOK, r.JSON(VernemqErrorResponse))
@@ -0,0 +1,60 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     request.go
+ * +===============================================
+ */
+
+package actions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/FANIoT/link/core"
+	"github.com/gobuffalo/buffalo"
+)
+
+// RequestIDHeader is the header of request identification
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID is a middleware that uses request identification of client or creates
+// a new one. identification is returned in the response header and states of the request
+// have it in their pipeline logs.
+func RequestID(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		id := c.Request().Header.Get(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+
+		c.Set("request_id", id)
+		c.Response().Header().Set(RequestIDHeader, id)
+
+		return next(c)
+	}
+}
+
+// newRequestID creates a random request identification
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestContext returns a context that carries request identification into core application
+func requestContext(c buffalo.Context) context.Context {
+	id, _ := c.Value("request_id").(string)
+	return core.WithRequestID(c, id)
+}
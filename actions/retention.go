@@ -0,0 +1,54 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     retention.go
+ * +===============================================
+ */
+
+package actions
+
+import (
+	"net/http"
+
+	"github.com/FANIoT/link/core"
+	"github.com/gobuffalo/buffalo"
+)
+
+// RetentionHandler returns retention policy of the project
+// This function is mapped to the path GET /retentions/{project_id}
+func RetentionHandler(c buffalo.Context) error {
+	return c.Render(http.StatusOK, r.JSON(coreApp.Retention(c, c.Param("project_id"))))
+}
+
+// RetentionPutHandler sets retention policy of the project. durations are like 720h
+// and empty durations keep states forever.
+// This function is mapped to the path PUT /retentions/{project_id}
+func RetentionPutHandler(c buffalo.Context) error {
+	var rq core.RetentionPolicy
+	if err := c.Bind(&rq); err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	p, err := coreApp.SetRetention(c, c.Param("project_id"), rq)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(p))
+}
+
+// RetentionDeleteHandler removes retention policy of the project so it uses the default one
+// This function is mapped to the path DELETE /retentions/{project_id}
+func RetentionDeleteHandler(c buffalo.Context) error {
+	if err := coreApp.DeleteRetention(c, c.Param("project_id")); err != nil {
+		return c.Error(http.StatusNotFound, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(true))
+}
@@ -0,0 +1,115 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     rule.go
+ * +===============================================
+ */
+
+package actions
+
+import (
+	"net/http"
+
+	"github.com/FANIoT/link/core"
+	"github.com/gobuffalo/buffalo"
+)
+
+// ruleError renders rule errors, disabled rules are not implemented
+func ruleError(c buffalo.Context, status int, err error) error {
+	if err == core.ErrRulesDisabled {
+		return c.Error(http.StatusNotImplemented, err)
+	}
+	return c.Error(status, err)
+}
+
+// RulesHandler lists rules of the project
+// This function is mapped to the path GET /rules/{project_id}
+func RulesHandler(c buffalo.Context) error {
+	rs, err := coreApp.Rules(c, c.Param("project_id"))
+	if err != nil {
+		return ruleError(c, http.StatusInternalServerError, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(rs))
+}
+
+// RuleCreateHandler creates a rule for the project
+// This function is mapped to the path POST /rules/{project_id}
+func RuleCreateHandler(c buffalo.Context) error {
+	var rq core.Rule
+	if err := c.Bind(&rq); err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+	rq.ID = ""
+
+	rl, err := coreApp.PutRule(c, c.Param("project_id"), rq)
+	if err != nil {
+		return ruleError(c, http.StatusBadRequest, err)
+	}
+
+	return c.Render(http.StatusCreated, r.JSON(rl))
+}
+
+// RuleHandler returns a rule of the project
+// This function is mapped to the path GET /rules/{project_id}/{rule_id}
+func RuleHandler(c buffalo.Context) error {
+	rl, err := coreApp.RuleByID(c, c.Param("project_id"), c.Param("rule_id"))
+	if err != nil {
+		return ruleError(c, http.StatusNotFound, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(rl))
+}
+
+// RuleUpdateHandler replaces a rule of the project, its changes are applied without restart
+// This function is mapped to the path PUT /rules/{project_id}/{rule_id}
+func RuleUpdateHandler(c buffalo.Context) error {
+	if _, err := coreApp.RuleByID(c, c.Param("project_id"), c.Param("rule_id")); err != nil {
+		return ruleError(c, http.StatusNotFound, err)
+	}
+
+	var rq core.Rule
+	if err := c.Bind(&rq); err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+	rq.ID = c.Param("rule_id")
+
+	rl, err := coreApp.PutRule(c, c.Param("project_id"), rq)
+	if err != nil {
+		return ruleError(c, http.StatusBadRequest, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(rl))
+}
+
+// RuleDeleteHandler removes a rule of the project
+// This function is mapped to the path DELETE /rules/{project_id}/{rule_id}
+func RuleDeleteHandler(c buffalo.Context) error {
+	if err := coreApp.DeleteRule(c, c.Param("project_id"), c.Param("rule_id")); err != nil {
+		return ruleError(c, http.StatusNotFound, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(true))
+}
+
+// AlertsHandler lists the newest alerts of the project
+// This function is mapped to the path GET /alerts/{project_id}?limit={limit}
+func AlertsHandler(c buffalo.Context) error {
+	limit, err := limitParam(c, 100)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	as, err := coreApp.Alerts(c, c.Param("project_id"), limit)
+	if err != nil {
+		return ruleError(c, http.StatusInternalServerError, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(as))
+}
@@ -0,0 +1,55 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     shadow.go
+ * +===============================================
+ */
+
+package actions
+
+import (
+	"net/http"
+
+	"github.com/FANIoT/link/core"
+	"github.com/gobuffalo/buffalo"
+)
+
+// ShadowHandler returns the device shadow of the thing with its delta
+// This function is mapped to the path GET /things/{thing_id}/shadow
+func ShadowHandler(c buffalo.Context) error {
+	s, err := coreApp.Shadow(c, c.Param("thing_id"))
+	if err != nil {
+		if err == core.ErrShadowsDisabled {
+			return c.Error(http.StatusNotImplemented, err)
+		}
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(s))
+}
+
+// ShadowPatchHandler updates the desired state of the thing assets.
+// request body maps asset names to their desired values and null removes desired value of an asset.
+// This function is mapped to the path PATCH /things/{thing_id}/shadow
+func ShadowPatchHandler(c buffalo.Context) error {
+	var rq map[string]interface{}
+	if err := c.Bind(&rq); err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	s, err := coreApp.Desire(c, c.Param("thing_id"), rq)
+	if err != nil {
+		if err == core.ErrShadowsDisabled {
+			return c.Error(http.StatusNotImplemented, err)
+		}
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(s))
+}
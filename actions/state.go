@@ -0,0 +1,59 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     state.go
+ * +===============================================
+ */
+
+package actions
+
+import (
+	"net/http"
+
+	"github.com/FANIoT/link/core"
+	"github.com/FANIoT/types"
+	"github.com/gobuffalo/buffalo"
+)
+
+// StateHandler returns the latest state of each asset of the thing
+// as json or as senml when the request accepts senml json or cbor.
+// senml responses have no units because units are not kept on ingest.
+// This function is mapped to the path GET /things/{thing_id}/state
+func StateHandler(c buffalo.Context) error {
+	ss, err := coreApp.States(c, c.Param("thing_id"))
+	if err != nil {
+		if err == core.ErrNoQuerier {
+			return c.Error(http.StatusNotImplemented, err)
+		}
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	if rr, ok := senmlRenderer(c.Request().Header.Get("Accept"), ss); ok {
+		return c.Render(http.StatusOK, rr)
+	}
+	return c.Render(http.StatusOK, r.JSON(ss))
+}
+
+// AssetStateHandler returns the latest state of the thing asset
+// as json or as a single record senml pack when the request accepts senml.
+// This function is mapped to the path GET /things/{thing_id}/assets/{asset}/state
+func AssetStateHandler(c buffalo.Context) error {
+	s, err := coreApp.AssetState(c, c.Param("thing_id"), c.Param("asset"))
+	if err != nil {
+		if err == core.ErrNoQuerier {
+			return c.Error(http.StatusNotImplemented, err)
+		}
+		return c.Error(http.StatusNotFound, err)
+	}
+
+	if rr, ok := senmlRenderer(c.Request().Header.Get("Accept"), []types.State{s}); ok {
+		return c.Render(http.StatusOK, rr)
+	}
+	return c.Render(http.StatusOK, r.JSON(s))
+}
@@ -14,12 +14,20 @@
 package actions
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/FANIoT/link/core"
 	"github.com/FANIoT/link/pm"
+	"github.com/FANIoT/link/senml"
 	"github.com/FANIoT/types"
 	"github.com/FANIoT/types/connectivity"
 	"github.com/gobuffalo/buffalo"
@@ -37,44 +45,167 @@ type TTNRequest struct {
 	Port           int    `json:"port"`
 	Counter        int    `json:"counter"`
 	PayloadRaw     []byte `json:"payload_raw"`
+	DownlinkURL    string `json:"downlink_url"`
 
 	Metadata struct {
 		Time time.Time `json:"time"`
 	} `json:"metadata"`
 }
 
+// TTNDownlinkRequest is a data format that ttn http integration module accepts for downlinks
+type TTNDownlinkRequest struct {
+	DevID      string `json:"dev_id"`
+	Port       int    `json:"port"`
+	Confirmed  bool   `json:"confirmed"`
+	PayloadRaw []byte `json:"payload_raw"`
+}
+
+// ttnDevice is a ttn device with its downlink url that is given on its last uplink
+type ttnDevice struct {
+	DevID       string
+	Port        int
+	DownlinkURL string
+}
+
+// TTNDownlink delivers commands to ttn devices with their downlink urls.
+// downlink urls are given on each uplink so commands of a device cannot
+// be delivered before its first uplink. they must be https urls on one of
+// the ttn handler hosts so uplinks cannot make link request arbitrary urls.
+type TTNDownlink struct {
+	devices map[string]ttnDevice
+	lock    sync.RWMutex
+
+	hosts  map[string]bool
+	client *http.Client
+}
+
+// defaultTTNSecret is the default TTN_SECRET that must be changed when downlinks are enabled
+const defaultTTNSecret = "ttnIStheBEST"
+
+var ttnDownlink = &TTNDownlink{
+	devices: make(map[string]ttnDevice),
+	hosts:   make(map[string]bool),
+	client: &http.Client{
+		Timeout: 10 * time.Second,
+	},
+}
+
+// Name returns ttn connectivity name
+func (*TTNDownlink) Name() string {
+	return "ttn"
+}
+
+// enabled returns true when there is any ttn handler host for downlinks
+func (d *TTNDownlink) enabled() bool {
+	return len(d.hosts) > 0
+}
+
+// validate checks that given downlink url is an https url on one of the ttn handler hosts
+func (d *TTNDownlink) validate(downlinkURL string) error {
+	u, err := url.Parse(downlinkURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("Downlink url %s is not https", downlinkURL)
+	}
+	if !d.hosts[strings.ToLower(u.Hostname())] {
+		return fmt.Errorf("Downlink url %s is not on ttn handler hosts", downlinkURL)
+	}
+	return nil
+}
+
+// set stores downlink url of thing
+func (d *TTNDownlink) set(thingID string, dev ttnDevice) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.devices[thingID] = dev
+}
+
+// Deliver sends command to ttn downlink url of the thing
+func (d *TTNDownlink) Deliver(ctx context.Context, t types.Thing, cmd core.Command) (core.CommandStatus, error) {
+	d.lock.RLock()
+	dev, ok := d.devices[t.ID]
+	d.lock.RUnlock()
+	if !ok {
+		return core.CommandQueued, fmt.Errorf("Thing %s does not have any ttn uplink", t.ID)
+	}
+	if err := d.validate(dev.DownlinkURL); err != nil {
+		return core.CommandQueued, err
+	}
+
+	b, err := json.Marshal(TTNDownlinkRequest{
+		DevID:      dev.DevID,
+		Port:       dev.Port,
+		PayloadRaw: cmd.Payload,
+	})
+	if err != nil {
+		return core.CommandQueued, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, dev.DownlinkURL, bytes.NewReader(b))
+	if err != nil {
+		return core.CommandQueued, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return core.CommandQueued, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return core.CommandQueued, fmt.Errorf("TTN downlink failed with %s", resp.Status)
+	}
+
+	return core.CommandSent, nil
+}
+
 // TTNAuthorize checks Authorization header to find out is it a valid TheThingsNetwork request
 // Please consider that this function is a miidleware
 func TTNAuthorize(next buffalo.Handler) buffalo.Handler {
 	return func(c buffalo.Context) error {
 		authString := c.Request().Header.Get("Authorization")
-		if authString != envy.Get("TTN_SECRET", "ttnIStheBEST") {
+		if authString != envy.Get("TTN_SECRET", defaultTTNSecret) {
 			return c.Error(http.StatusUnauthorized, fmt.Errorf("unathorized access token"))
 		}
 		return next(c)
 	}
 }
 
+// ttnMalformedStatus returns status code of malformed ttn requests. TheThingsNetwork retries
+// requests on non-2xx status codes so malformed requests are answered with 200 unless TTN_STRICT is true.
+func ttnMalformedStatus() int {
+	if envy.Get("TTN_STRICT", "false") == "true" {
+		return http.StatusBadRequest
+	}
+	return http.StatusOK
+}
+
 // TTNHandler provides an endpoint for TheThingsNetwork HTTP integration
 // https://www.thethingsnetwork.org/docs/applications/http/
 // This function is mapped to the path POST /ttn/{project_id}
-// TODO it tries to decode given data with CBOR but is must improve to support
-// more protocol and better configuration
+// payloads are decoded with CBOR or SenML CBOR based on TTN_FORMAT.
 func TTNHandler(c buffalo.Context) error {
 	projectID := c.Param("project_id")
 	var thingID string
 
+	rsp := newPushResponse(c)
+
 	var rq TTNRequest
 	if err := c.Bind(&rq); err != nil {
-		return c.Error(http.StatusBadRequest, err)
+		rsp.Error = fmt.Sprintf("request is not a valid ttn uplink: %s", err)
+		return c.Render(ttnMalformedStatus(), r.JSON(rsp))
 	}
 	coreApp.Logger.WithFields(logrus.Fields{
-		"component": "ttn service",
+		"component":  "ttn service",
+		"request_id": rsp.RequestID,
 	}).Infof("Incoming data from %s @ %s with pid: %s", rq.DevID, rq.AppID, projectID)
 
 	// return if there is no payload
 	if rq.PayloadRaw == nil {
-		return c.Render(http.StatusOK, r.JSON(true))
+		return c.Render(http.StatusOK, r.JSON(rsp))
 	}
 
 	ts, err := pm.ThingsByProject(c, projectID)
@@ -95,24 +226,77 @@ func TTNHandler(c buffalo.Context) error {
 		return c.Error(http.StatusNotFound, fmt.Errorf("Device %s on Application %s with ProjectID %s Not Found", rq.DevID, rq.AppID, projectID))
 	}
 
-	states := make(map[interface{}]interface{})
-	if err := codec.NewDecoderBytes(rq.PayloadRaw, new(codec.CborHandle)).Decode(&states); err != nil {
+	if rq.DownlinkURL != "" && ttnDownlink.enabled() {
+		if err := ttnDownlink.validate(rq.DownlinkURL); err != nil {
+			coreApp.Logger.WithFields(logrus.Fields{
+				"component":  "ttn service",
+				"request_id": rsp.RequestID,
+			}).Warnf("Downlink of %s @ %s is ignored: %s", rq.DevID, rq.AppID, err)
+		} else {
+			ttnDownlink.set(thingID, ttnDevice{
+				DevID:       rq.DevID,
+				Port:        rq.Port,
+				DownlinkURL: rq.DownlinkURL,
+			})
+		}
+	}
+
+	states, err := ttnStates(rq, thingID, projectID)
+	if err != nil {
 		coreApp.Logger.WithFields(logrus.Fields{
-			"component": "ttn service",
-		}).Errorf("Incoming data from %s @ %s with pid: %s is not a valid cbor (%q) %s", rq.DevID, rq.AppID, projectID, rq.PayloadRaw, err)
-		return c.Render(http.StatusOK, r.JSON(true))
+			"component":  "ttn service",
+			"request_id": rsp.RequestID,
+		}).Errorf("Incoming data from %s @ %s with pid: %s is not valid (%q) %s", rq.DevID, rq.AppID, projectID, rq.PayloadRaw, err)
+
+		rsp.Error = fmt.Sprintf("payload is not valid: %s", err)
+		return c.Render(ttnMalformedStatus(), r.JSON(rsp))
+	}
+
+	now := time.Now()
+	for i, state := range states {
+		rr, err := push(c, state, nil, now)
+		if err != nil {
+			return interrupted(c, rsp, err)
+		}
+		rr.Index = i
+		rsp.add(rr)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(rsp))
+}
+
+// ttnStates decodes ttn payload into states. payload is a map of assets to their values in CBOR
+// or SenML records in CBOR when TTN_FORMAT is senml.
+func ttnStates(rq TTNRequest, thingID string, projectID string) ([]types.State, error) {
+	// payloads are senml records when ttn format is senml
+	if envy.Get("TTN_FORMAT", "cbor") == "senml" {
+		p, err := senml.DecodeCBOR(rq.PayloadRaw)
+		if err != nil {
+			return nil, err
+		}
+
+		return p.States(thingID, projectID, rq.Metadata.Time)
 	}
 
-	for name, value := range states {
-		state := types.State{
+	values := make(map[interface{}]interface{})
+	if err := codec.NewDecoderBytes(rq.PayloadRaw, new(codec.CborHandle)).Decode(&values); err != nil {
+		return nil, err
+	}
+
+	states := make([]types.State, 0, len(values))
+	for name, value := range values {
+		states = append(states, types.State{
 			Raw:     value,
 			At:      rq.Metadata.Time,
 			ThingID: thingID,
 			Project: projectID,
 			Asset:   fmt.Sprintf("%v", name), // convert anything to string (is there any better way?)
-		}
-		coreApp.Data(state)
+		})
 	}
+	// assets are sorted so response has a stable order
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Asset < states[j].Asset
+	})
 
-	return c.Render(http.StatusOK, r.JSON(true))
+	return states, nil
 }
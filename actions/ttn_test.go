@@ -0,0 +1,27 @@
+package actions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTNDownlinkValidate(t *testing.T) {
+	d := &TTNDownlink{
+		hosts: map[string]bool{"integrations.thethingsnetwork.org": true},
+	}
+
+	assert.NoError(t, d.validate("https://integrations.thethingsnetwork.org/ttn-eu/api/v2/down/app/link?key=ttn-account-v2.secret"))
+	assert.NoError(t, d.validate("https://Integrations.TheThingsNetwork.org:443/down"))
+
+	for _, u := range []string{
+		"http://integrations.thethingsnetwork.org/down",
+		"https://169.254.169.254/latest/meta-data",
+		"https://integrations.thethingsnetwork.org.evil.com/down",
+		"https://evil.com@localhost/down",
+		"file:///etc/passwd",
+		"://",
+	} {
+		assert.Error(t, d.validate(u), u)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     aggregate.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/FANIoT/types"
+)
+
+// Buckets are the supported aggregation time buckets
+var Buckets = map[string]time.Duration{
+	"1m": time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// aggregatePageSize is number of states in each read of in-memory aggregation
+const aggregatePageSize = 1000
+
+// Bucket has aggregated numeric values of an asset in a time bucket that starts at its time
+type Bucket struct {
+	At    time.Time `json:"at" bson:"at"`
+	Min   float64   `json:"min" bson:"min"`
+	Max   float64   `json:"max" bson:"max"`
+	Mean  float64   `json:"mean" bson:"mean"`
+	Count int64     `json:"count" bson:"count"`
+	Last  float64   `json:"last" bson:"last"`
+}
+
+// numeric reports whether state has a number value based on its raw type, because zero values are omitted
+// from value so zero numbers are not distinguishable from false, "" or null there. decoded states have
+// their binary payload as raw so they are numeric when they have a non-zero number.
+func numeric(s types.State) bool {
+	switch s.Raw.(type) {
+	case float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	case []byte:
+		return s.Value.Number != 0
+	}
+	return false
+}
+
+// aggregate adds numeric states to their buckets. states must be sorted by their time
+// and buckets are kept in the order of their time.
+func aggregate(buckets []Bucket, ss []types.State, bucket time.Duration) []Bucket {
+	for _, s := range ss {
+		if !numeric(s) {
+			continue
+		}
+
+		at := s.At.Truncate(bucket)
+		v := s.Value.Number
+
+		if n := len(buckets); n > 0 && buckets[n-1].At.Equal(at) {
+			b := &buckets[n-1]
+			b.Min = math.Min(b.Min, v)
+			b.Max = math.Max(b.Max, v)
+			b.Mean += (v - b.Mean) / float64(b.Count+1)
+			b.Count++
+			b.Last = v
+			continue
+		}
+
+		buckets = append(buckets, Bucket{
+			At:    at,
+			Min:   v,
+			Max:   v,
+			Mean:  v,
+			Count: 1,
+			Last:  v,
+		})
+	}
+	return buckets
+}
+
+// Aggregate returns min, max, mean, count and last of thing asset numeric states in each
+// time bucket. sinks that aggregate themselves are preferred and otherwise states are read
+// from the first sink that supports queries and they are aggregated in memory.
+func (a *Application) Aggregate(ctx context.Context, project string, thingID string, asset string, from time.Time, to time.Time, bucket time.Duration) ([]Bucket, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("Invalid bucket %s", bucket)
+	}
+
+	for _, s := range a.sinks {
+		if ag, ok := s.(Aggregator); ok {
+			return ag.Aggregate(ctx, project, thingID, asset, from, to, bucket)
+		}
+	}
+
+	q, err := a.querier()
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]Bucket, 0)
+	for skip := 0; ; skip += aggregatePageSize {
+		ss, err := q.Range(ctx, project, thingID, asset, from, to, skip, aggregatePageSize)
+		if err != nil {
+			return nil, err
+		}
+		buckets = aggregate(buckets, ss, bucket)
+		if len(ss) < aggregatePageSize {
+			break
+		}
+	}
+
+	return buckets, nil
+}
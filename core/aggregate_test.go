@@ -0,0 +1,81 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     aggregate_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregate(t *testing.T) {
+	s := NewMemorySink()
+	a := &Application{
+		sinks: []Sink{s},
+	}
+	now := time.Date(2018, 10, 18, 10, 20, 0, 0, time.UTC)
+
+	// false and "" have zero values like the zero number but they are not numeric
+	ss := make([]types.State, 0)
+	for i, v := range []interface{}{18.0, 20.0, "18.20", 22.0, 10.0, false, ""} {
+		st := types.State{
+			ThingID: tID,
+			Project: "el-project",
+			Asset:   aName,
+			At:      now.Add(time.Duration(i) * 20 * time.Second),
+			Raw:     v,
+		}
+		fillValue(&st, v)
+		ss = append(ss, st)
+	}
+	assert.NoError(t, s.Insert(context.Background(), ss))
+
+	bs, err := a.Aggregate(context.Background(), "el-project", tID, aName, now, time.Time{}, Buckets["1m"])
+	assert.NoError(t, err)
+	assert.Len(t, bs, 2)
+	assert.Equal(t, Bucket{At: now, Min: 18, Max: 20, Mean: 19, Count: 2, Last: 20}, bs[0])
+	assert.Equal(t, Bucket{At: now.Add(time.Minute), Min: 10, Max: 22, Mean: 16, Count: 2, Last: 10}, bs[1])
+
+	bs, err = a.Aggregate(context.Background(), "el-project", tID, aName, now, time.Time{}, Buckets["1d"])
+	assert.NoError(t, err)
+	assert.Len(t, bs, 1)
+	assert.Equal(t, int64(4), bs[0].Count)
+	assert.Equal(t, 17.5, bs[0].Mean)
+	assert.Equal(t, now.Truncate(24*time.Hour), bs[0].At)
+}
+
+func TestNumeric(t *testing.T) {
+	for _, v := range []interface{}{0.0, 18.20, 0, int64(18), uint8(18)} {
+		s := types.State{Raw: v}
+		fillValue(&s, v)
+		assert.True(t, numeric(s), "%v", v)
+	}
+
+	for _, v := range []interface{}{false, "", nil, "18.20", []interface{}{}, map[string]interface{}{}} {
+		s := types.State{Raw: v}
+		fillValue(&s, v)
+		assert.False(t, numeric(s), "%v", v)
+	}
+
+	// decoded states have their payload as raw
+	s := types.State{Raw: []byte{18}}
+	fillValue(&s, 18.0)
+	assert.True(t, numeric(s))
+	s = types.State{Raw: []byte{0}}
+	fillValue(&s, false)
+	assert.False(t, numeric(s))
+}
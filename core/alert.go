@@ -0,0 +1,372 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     alert.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/mongodb/mongo-go-driver/bson"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
+	"github.com/sirupsen/logrus"
+)
+
+// AlertStatus is the status of rule in its alert
+type AlertStatus string
+
+// Alert statuses
+const (
+	AlertFiring   AlertStatus = "firing"   // rule condition holds for its duration
+	AlertResolved AlertStatus = "resolved" // value crosses the threshold back by rule hysteresis
+)
+
+// Alert is an event that is emitted when a rule fires or it is resolved
+type Alert struct {
+	ID         string      `json:"id" bson:"_id"`
+	RuleID     string      `json:"rule_id" bson:"rule_id"`
+	Rule       string      `json:"rule" bson:"rule"`
+	Expression string      `json:"expression" bson:"expression"`
+	Status     AlertStatus `json:"status" bson:"status"`
+	Project    string      `json:"project" bson:"project"`
+	ThingID    string      `json:"thingid" bson:"thingid"`
+	Asset      string      `json:"asset" bson:"asset"`
+	Value      float64     `json:"value" bson:"value"`
+	At         time.Time   `json:"at" bson:"at"`
+}
+
+// newAlert creates alert of rule on given state
+func newAlert(r Rule, s types.State, status AlertStatus) Alert {
+	return Alert{
+		ID:         newID(),
+		RuleID:     r.ID,
+		Rule:       r.Name,
+		Expression: r.Expression,
+		Status:     status,
+		Project:    s.Project,
+		ThingID:    s.ThingID,
+		Asset:      s.Asset,
+		Value:      s.Value.Number,
+		At:         s.At,
+	}
+}
+
+// ruleAlert is an alert with the webhook of its rule
+type ruleAlert struct {
+	Alert
+	webhook string
+}
+
+// AlertStore stores history of alerts
+type AlertStore interface {
+	Put(ctx context.Context, a Alert) error
+	// List returns the newest alerts of project
+	List(ctx context.Context, project string, limit int) ([]Alert, error)
+
+	Name() string
+}
+
+// MongoAlerts stores alerts in alerts collection
+type MongoAlerts struct {
+	c *mgo.Collection
+}
+
+// NewMongoAlerts creates alerts store on given database
+func NewMongoAlerts(db *mgo.Database) *MongoAlerts {
+	return &MongoAlerts{
+		c: db.Collection("alerts"),
+	}
+}
+
+// Name returns mongo alerts name
+func (*MongoAlerts) Name() string {
+	return "mongo"
+}
+
+// Put inserts given alert
+func (m *MongoAlerts) Put(ctx context.Context, a Alert) error {
+	_, err := m.c.InsertOne(ctx, a)
+	return err
+}
+
+// List returns the newest alerts of project
+func (m *MongoAlerts) List(ctx context.Context, project string, limit int) ([]Alert, error) {
+	as := make([]Alert, 0)
+
+	cur, err := m.c.Find(ctx, bson.NewDocument(
+		bson.EC.String("project", project),
+	), findopt.Sort(bson.NewDocument(
+		bson.EC.Int32("at", -1),
+	)), findopt.Limit(int64(limit)))
+	if err != nil {
+		return as, err
+	}
+
+	for cur.Next(ctx) {
+		var a Alert
+
+		if err := cur.Decode(&a); err != nil {
+			return as, err
+		}
+
+		as = append(as, a)
+	}
+	if err := cur.Close(ctx); err != nil {
+		return as, err
+	}
+
+	return as, nil
+}
+
+// MemoryAlerts stores alerts in memory
+type MemoryAlerts struct {
+	alerts []Alert
+	lock   sync.RWMutex
+}
+
+// NewMemoryAlerts creates an empty memory alert store
+func NewMemoryAlerts() *MemoryAlerts {
+	return &MemoryAlerts{
+		alerts: make([]Alert, 0),
+	}
+}
+
+// Name returns memory alerts name
+func (*MemoryAlerts) Name() string {
+	return "memory"
+}
+
+// Put appends given alert
+func (m *MemoryAlerts) Put(_ context.Context, a Alert) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.alerts = append(m.alerts, a)
+	return nil
+}
+
+// List returns the newest alerts of project
+func (m *MemoryAlerts) List(_ context.Context, project string, limit int) ([]Alert, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	as := make([]Alert, 0)
+	for _, a := range m.alerts {
+		if a.Project == project {
+			as = append(as, a)
+		}
+	}
+	sort.SliceStable(as, func(i, j int) bool {
+		return as[i].At.After(as[j].At)
+	})
+	if limit > 0 && len(as) > limit {
+		as = as[:limit]
+	}
+	return as, nil
+}
+
+// Alerts returns the newest alerts of project
+func (a *Application) Alerts(ctx context.Context, project string, limit int) ([]Alert, error) {
+	if a.alerts == nil {
+		return nil, ErrRulesDisabled
+	}
+
+	return a.alerts.List(ctx, project, limit)
+}
+
+// privateNetworks are the networks that webhooks cannot be posted to when there is no webhook host
+var privateNetworks = func() []*net.IPNet {
+	ns := make([]*net.IPNet, 0)
+	for _, cidr := range []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+		"172.16.0.0/12", "192.168.0.0/16", "224.0.0.0/4", "::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		ns = append(ns, n)
+	}
+	return ns
+}()
+
+// errPrivateWebhook is returned when webhook address is not public
+var errPrivateWebhook = errors.New("Rule webhook address is not public")
+
+// publicIP reports whether ip is not in any of the private networks
+func publicIP(ip net.IP) bool {
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateWebhook checks that webhook is an http or https url on one of the webhook hosts.
+// without any webhook host, webhook must not be on localhost or a private address.
+func (a *Application) validateWebhook(webhook string) error {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return fmt.Errorf("Invalid rule webhook %q: %s", webhook, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("Rule webhook %s is not http or https", webhook)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("Rule webhook %s does not have any host", webhook)
+	}
+	if len(a.webhookHosts) > 0 {
+		if !a.webhookHosts[host] {
+			return fmt.Errorf("Rule webhook %s is not on webhook hosts", webhook)
+		}
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errPrivateWebhook
+	}
+	if ip := net.ParseIP(host); ip != nil && !publicIP(ip) {
+		return errPrivateWebhook
+	}
+	return nil
+}
+
+// newWebhookClient creates the webhooks client. without any webhook host it does not
+// connect to private addresses so webhook hostnames cannot resolve into the internal network.
+// redirects are validated like the webhooks.
+func (a *Application) newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			if len(a.webhookHosts) > 0 {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return errPrivateWebhook
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: dialer.DialContext,
+		},
+		CheckRedirect: func(r *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("Rule webhook has too many redirects")
+			}
+			return a.validateWebhook(r.URL.String())
+		},
+	}
+}
+
+// alert stores given alert and publishes it on the following topic
+// i1820/projects/{project_id}/alerts
+// and it posts alert to the rule webhook when rule has one.
+func (a *Application) alert(al Alert, webhook string) {
+	logger := a.Logger.WithFields(logrus.Fields{
+		"component": "link",
+		"rule":      al.RuleID,
+		"asset":     al.Asset,
+		"thingid":   al.ThingID,
+	})
+	logger.Infof("Rule is %s with %g", al.Status, al.Value)
+
+	if err := a.alerts.Put(context.Background(), al); err != nil {
+		logger.Errorf("Alert store error: %s", err)
+	}
+
+	b, err := json.Marshal(al)
+	if err != nil {
+		logger.Errorf("Marshal alert error: %s", err)
+		return
+	}
+
+	a.cli.Publish(fmt.Sprintf("i1820/projects/%s/alerts", al.Project), 1, false, b)
+
+	if webhook == "" {
+		return
+	}
+	// rules that are stored before webhooks validation may have invalid webhooks
+	if err := a.validateWebhook(webhook); err != nil {
+		logger.Errorf("Alert webhook error: %s", err)
+		return
+	}
+	resp, err := a.webhooks.Post(webhook, "application/json", bytes.NewReader(b))
+	if err != nil {
+		logger.Errorf("Alert webhook error: %s", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		logger.Errorf("Alert webhook failed with %s", resp.Status)
+	}
+}
+
+// alertStage emits alerts of its queue one by one so alerts of each rule are emitted in order
+func (a *Application) alertStage(q chan ruleAlert) {
+	for ra := range q {
+		a.alert(ra.Alert, ra.webhook)
+	}
+	a.alertCloseCounter.Done()
+}
+
+// runAlerts runs alert stages, each one with its own bounded queue
+func (a *Application) runAlerts(workers int, size int) {
+	a.alertQueues = make([]chan ruleAlert, workers)
+	for i := range a.alertQueues {
+		a.alertQueues[i] = make(chan ruleAlert, size)
+		a.alertCloseCounter.Add(1)
+		go a.alertStage(a.alertQueues[i])
+	}
+}
+
+// closeAlerts closes alert queues and waits for their stages to emit the remaining alerts
+func (a *Application) closeAlerts() {
+	for _, q := range a.alertQueues {
+		close(q)
+	}
+	a.alertCloseCounter.Wait()
+}
+
+// evaluate evaluates rules on decoded state and queues their alerts. alerts of each rule
+// are queued in order of evaluation into the same alert stage and evaluate blocks when its queue is full.
+func (a *Application) evaluate(s types.State) {
+	a.alertLock.Lock()
+	defer a.alertLock.Unlock()
+
+	for _, ra := range a.engine.evaluate(s) {
+		h := fnv.New32a()
+		h.Write([]byte(ra.RuleID))
+		a.alertQueues[h.Sum32()%uint32(len(a.alertQueues))] <- ra
+	}
+}
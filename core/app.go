@@ -15,16 +15,22 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/FANIoT/types"
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gobuffalo/envy"
-	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	cache "github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
@@ -32,6 +38,23 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
+// Overflow specifies what Data does when pipeline queue is full
+type Overflow string
+
+// Overflow modes
+const (
+	OverflowBlock      Overflow = "block"       // waits until there is room in the queue or context is done
+	OverflowDropNewest Overflow = "drop-newest" // drops the incoming state
+	OverflowDropOldest Overflow = "drop-oldest" // drops the oldest state in the queue
+	OverflowReject     Overflow = "reject"      // returns ErrQueueFull
+)
+
+// Data errors
+var (
+	ErrNotRunning = errors.New("You cann't pass data into application when it is not running")
+	ErrQueueFull  = errors.New("Pipeline queue is full")
+)
+
 // Application is a main part of link component that consists of
 // mqtt client and protocols that provide information for mqtt connectivity
 // Application is used with link services in order to process
@@ -44,41 +67,308 @@ type Application struct {
 
 	Logger *logrus.Logger
 
-	session *mgo.Client
-	db      *mgo.Database
+	// insert stage writes states into all of these sinks
+	sinks []Sink
 
-	// pipeline channels
-	projectStream chan *types.State
-	decodeStream  chan *types.State
-	insertStream  chan *types.State
+	// failed states are retried based on their stage policy and then
+	// they are stored as dead letters
+	projectRetry RetryPolicy
+	insertRetry  RetryPolicy
+	deadLetters  DeadLetters
+
+	// insert stage batches states and inserts them when a batch has batchSize states
+	// or on each batchInterval
+	batchSize     int
+	batchInterval time.Duration
+
+	// generic models of things and their limits
+	generics           map[string]*Generic
+	genericsLock       sync.Mutex
+	scriptTimeout      time.Duration
+	scriptPayloadLimit int
+	scriptAssetsLimit  int
+	scriptMemoryLimit  int
+
+	// compiled expressions of virtual assets by their expression
+	virtuals     map[string]*expression
+	virtualsLock sync.Mutex
+
+	// optional write-ahead log, data is appended into it and
+	// pipeline reads from it
+	wal            *WAL
+	walDir         string
+	walSegmentSize int64
+	walSync        bool
+	walCloseChan   chan struct{}    // wal reader closes this channel on its return
+	parked         *FileDeadLetters // states that are not inserted or dead lettered are parked beside wal
+
+	// pipeline channels have queueSize capacity and overflow
+	// specifies what happens when project stream is full
+	queueSize int
+	overflow  Overflow
+
+	// pipeline is partitioned into lanes. in ordered mode each thing always goes into the same lane
+	// and each lane has one instance of each stage, so states of a thing are processed in order.
+	// otherwise there is one lane with runtime.NumCPU() instances of each stage.
+	ordered bool
+	nLanes  int
+	lanes   []*lane
+
+	// commands are stored in the command store and they are delivered
+	// by the deliverer of their connectivity
+	commands       CommandStore
+	deliverers     map[string]Deliverer
+	deliverersLock sync.RWMutex
+	connectivity   string // default connectivity of commands
+	commandTTL     time.Duration
+	undelivered    *thingSet // things that have queued commands that are not delivered
+
+	// device shadows are optional, their deltas are pushed as commands
+	// at most once in each shadow push interval when things publish
+	shadows      ShadowStore
+	shadowPushes *cache.Cache
+
+	// maintainer sinks materialize hourly and daily rollups of the buckets that have new states
+	// on each rollup interval and they remove old states based on retention policies of projects
+	// on each retention interval. zero intervals disable them.
+	maintainers       []Maintainer
+	rollups           *rollupSet
+	rollupInterval    time.Duration
+	retentions        RetentionStore
+	retention         RetentionPolicy // default retention policy
+	retentionInterval time.Duration
+
+	// rules are evaluated on decoded states by the rule engine and they are
+	// reloaded from the rule store on each reload interval. alerts are stored and
+	// they are posted to the rule webhooks with the webhooks client by the alert stages.
+	// alerts of each rule are emitted by one alert stage so they are in order.
+	// webhooks are restricted to webhook hosts when there is any.
+	rules             RuleStore
+	alerts            AlertStore
+	engine            *ruleEngine
+	rulesReload       time.Duration
+	webhooks          *http.Client
+	webhookHosts      map[string]bool
+	alertWorkers      int
+	alertQueueSize    int
+	alertQueues       []chan ruleAlert
+	alertLock         sync.Mutex
+	alertCloseCounter sync.WaitGroup
+
+	// last-value cache of things states that is updated by decode stage
+	states *stateCache
+
+	// collects depth of the lanes streams
+	queues queueCollector
+
+	// opt-in per thing and per project ingestion metrics, each one
+	// has at most metricsLimit distinct things or projects
+	thingMetrics   bool
+	projectMetrics bool
+	metricsLimit   int
 
 	// in order to close the pipeline nicely
-	projectCloseChan   chan struct{}  // project stage sends one value to this channel on its return
-	decodeCloseChan    chan struct{}  // decode stage sends one value to this channel on its return
+	exitChan           chan struct{}  // it is closed when application is going to exit
 	insertCloseCounter sync.WaitGroup // count number of insert stages so `Exit` can wait for all of them
 
-	IsRun bool
+	// data calls hold the read lock so exit waits for them before closing the pipeline
+	running bool
+	runLock sync.RWMutex
 }
 
 // New creates new application. this function does not create mqtt client.
-// it creates mongodb session instance
-func New() *Application {
+// application stores states into given sinks and when there is no sink
+// it creates sinks based on SINKS environment variable (mongodb by default).
+func New(sinks ...Sink) *Application {
 	a := Application{}
 
 	a.Logger = logrus.New()
 
-	// Create a mongodb connection
-	url := envy.Get("DB_URL", "mongodb://127.0.0.1:27017")
-	session, err := mgo.NewClient(url)
+	// Create sinks
+	if len(sinks) == 0 {
+		ss, err := sinksFromEnv()
+		if err != nil {
+			a.Logger.Fatalf("Sink creation error: %s", err)
+		}
+		sinks = ss
+	}
+	a.sinks = sinks
+
+	// retry policies
+	projectRetry, err := retryPolicyFromEnv("project", "3", "100ms")
+	if err != nil {
+		a.Logger.Fatalf("Project retry policy parse error: %s", err)
+	}
+	a.projectRetry = projectRetry
+	insertRetry, err := retryPolicyFromEnv("insert", "5", "1s")
+	if err != nil {
+		a.Logger.Fatalf("Insert retry policy parse error: %s", err)
+	}
+	a.insertRetry = insertRetry
+
+	// insert stage batching
+	size, err := strconv.Atoi(envy.Get("DB_BATCH_SIZE", "100"))
+	if err != nil {
+		a.Logger.Fatalf("DB batch size parse error: %s", err)
+	}
+	a.batchSize = size
+	interval, err := time.ParseDuration(envy.Get("DB_BATCH_INTERVAL", "1s"))
+	if err != nil {
+		a.Logger.Fatalf("DB batch interval parse error: %s", err)
+	}
+	a.batchInterval = interval
+
+	// generic models limits
+	a.generics = make(map[string]*Generic)
+	a.virtuals = make(map[string]*expression)
+	timeout, err := time.ParseDuration(envy.Get("SCRIPT_TIMEOUT", "100ms"))
+	if err != nil {
+		a.Logger.Fatalf("Script timeout parse error: %s", err)
+	}
+	a.scriptTimeout = timeout
+	payload, err := strconv.Atoi(envy.Get("SCRIPT_PAYLOAD_LIMIT", "65536"))
+	if err != nil {
+		a.Logger.Fatalf("Script payload limit parse error: %s", err)
+	}
+	a.scriptPayloadLimit = payload
+	assets, err := strconv.Atoi(envy.Get("SCRIPT_ASSETS_LIMIT", "256"))
+	if err != nil {
+		a.Logger.Fatalf("Script assets limit parse error: %s", err)
+	}
+	a.scriptAssetsLimit = assets
+	memory, err := strconv.Atoi(envy.Get("SCRIPT_MEMORY_LIMIT", "33554432"))
+	if err != nil {
+		a.Logger.Fatalf("Script memory limit parse error: %s", err)
+	}
+	a.scriptMemoryLimit = memory
+
+	// write-ahead log is enabled when WAL_DIR is set
+	a.walDir = envy.Get("WAL_DIR", "")
+	segment, err := strconv.ParseInt(envy.Get("WAL_SEGMENT_SIZE", "67108864"), 10, 64)
 	if err != nil {
-		a.Logger.Fatalf("DB new client error: %s", err)
+		a.Logger.Fatalf("WAL segment size parse error: %s", err)
 	}
-	a.session = session
+	a.walSegmentSize = segment
+	a.walSync = envy.Get("WAL_SYNC", "false") == "true"
 
 	// pipeline channels
-	a.projectStream = make(chan *types.State)
-	a.decodeStream = make(chan *types.State)
-	a.insertStream = make(chan *types.State)
+	queue, err := strconv.Atoi(envy.Get("QUEUE_SIZE", "1024"))
+	if err != nil {
+		a.Logger.Fatalf("Queue size parse error: %s", err)
+	}
+	a.queueSize = queue
+	a.overflow = Overflow(envy.Get("OVERFLOW", string(OverflowBlock)))
+	switch a.overflow {
+	case OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowReject:
+	default:
+		a.Logger.Fatalf("Overflow %s is not supported", a.overflow)
+	}
+
+	// pipeline lanes
+	a.ordered = envy.Get("ORDERED", "false") == "true"
+	a.nLanes = 1
+	if a.ordered {
+		lanes, err := strconv.Atoi(envy.Get("LANES", strconv.Itoa(runtime.NumCPU())))
+		if err != nil {
+			a.Logger.Fatalf("Lanes parse error: %s", err)
+		}
+		a.nLanes = lanes
+	}
+
+	// last-value cache
+	cacheSize, err := strconv.Atoi(envy.Get("STATE_CACHE_SIZE", "10000"))
+	if err != nil {
+		a.Logger.Fatalf("State cache size parse error: %s", err)
+	}
+	cacheTTL, err := time.ParseDuration(envy.Get("STATE_CACHE_TTL", "1h"))
+	if err != nil {
+		a.Logger.Fatalf("State cache ttl parse error: %s", err)
+	}
+	a.states = newStateCache(cacheSize, cacheTTL)
+
+	// rules engine
+	a.engine = newRuleEngine()
+	reload, err := time.ParseDuration(envy.Get("RULES_RELOAD_INTERVAL", "30s"))
+	if err != nil {
+		a.Logger.Fatalf("Rules reload interval parse error: %s", err)
+	}
+	a.rulesReload = reload
+	webhook, err := time.ParseDuration(envy.Get("ALERT_WEBHOOK_TIMEOUT", "5s"))
+	if err != nil {
+		a.Logger.Fatalf("Alert webhook timeout parse error: %s", err)
+	}
+	a.webhookHosts = make(map[string]bool)
+	for _, host := range strings.Split(envy.Get("ALERT_WEBHOOK_HOSTS", ""), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			a.webhookHosts[host] = true
+		}
+	}
+	a.webhooks = a.newWebhookClient(webhook)
+	alertWorkers, err := strconv.Atoi(envy.Get("ALERT_WORKERS", "4"))
+	if err != nil || alertWorkers <= 0 {
+		a.Logger.Fatalf("Alert workers parse error: %q is not a positive number", envy.Get("ALERT_WORKERS", "4"))
+	}
+	a.alertWorkers = alertWorkers
+	alertQueue, err := strconv.Atoi(envy.Get("ALERT_QUEUE_SIZE", "1024"))
+	if err != nil {
+		a.Logger.Fatalf("Alert queue size parse error: %s", err)
+	}
+	a.alertQueueSize = alertQueue
+
+	// rollups and retention policies
+	a.maintainers = make([]Maintainer, 0)
+	for _, s := range a.sinks {
+		if m, ok := s.(Maintainer); ok {
+			a.maintainers = append(a.maintainers, m)
+		}
+	}
+	a.rollups = newRollupSet()
+	rollup, err := time.ParseDuration(envy.Get("ROLLUP_INTERVAL", "1m"))
+	if err != nil {
+		a.Logger.Fatalf("Rollup interval parse error: %s", err)
+	}
+	a.rollupInterval = rollup
+	retention, err := time.ParseDuration(envy.Get("RETENTION_INTERVAL", "1h"))
+	if err != nil {
+		a.Logger.Fatalf("Retention interval parse error: %s", err)
+	}
+	a.retentionInterval = retention
+	a.retention = RetentionPolicy{
+		Raw:    envy.Get("RETENTION_RAW", ""),
+		Hourly: envy.Get("RETENTION_HOURLY", ""),
+		Daily:  envy.Get("RETENTION_DAILY", ""),
+	}
+	if _, err := a.retention.retentions(); err != nil {
+		a.Logger.Fatalf("Default retention policy parse error: %s", err)
+	}
+
+	// commands
+	a.deliverers = map[string]Deliverer{
+		"http": pollingDeliverer{},
+	}
+	a.connectivity = envy.Get("COMMAND_CONNECTIVITY", "mqtt")
+	ttl, err := time.ParseDuration(envy.Get("COMMAND_TTL", "1h"))
+	if err != nil {
+		a.Logger.Fatalf("Command TTL parse error: %s", err)
+	}
+	a.commandTTL = ttl
+	a.undelivered = newThingSet()
+
+	// device shadows
+	push, err := time.ParseDuration(envy.Get("SHADOW_PUSH_INTERVAL", "30s"))
+	if err != nil {
+		a.Logger.Fatalf("Shadow push interval parse error: %s", err)
+	}
+	a.shadowPushes = cache.New(push, 2*push)
+
+	// ingestion metrics
+	a.thingMetrics = envy.Get("METRICS_THINGS", "false") == "true"
+	a.projectMetrics = envy.Get("METRICS_PROJECTS", "false") == "true"
+	limit, err := strconv.Atoi(envy.Get("METRICS_LIMIT", "1000"))
+	if err != nil {
+		a.Logger.Fatalf("Metrics limit parse error: %s", err)
+	}
+	a.metricsLimit = limit
 
 	return &a
 }
@@ -87,10 +377,13 @@ func New() *Application {
 // Application just submits data to mqtt so the authorization takes place in submit phase
 // not at registration phase.
 func (a *Application) Run() {
-	// create close channels here so we can run and stop single
+	// create channels here so we can run and stop single
 	// application many times
-	a.projectCloseChan = make(chan struct{}, 1)
-	a.decodeCloseChan = make(chan struct{}, 1)
+	a.exitChan = make(chan struct{})
+	a.lanes = make([]*lane, a.nLanes)
+	for i := range a.lanes {
+		a.lanes[i] = newLane(a.queueSize)
+	}
 
 	// Create an MQTT client
 	/*
@@ -113,45 +406,231 @@ func (a *Application) Run() {
 		a.Logger.Fatalf("MQTT session error: %s", t.Error())
 	}
 
-	// Connect to the mongodb
-	if err := a.session.Connect(context.Background()); err != nil {
-		a.Logger.Fatalf("DB connection error: %s", err)
+	// dead letters destination
+	if a.deadLetters == nil {
+		dl, err := deadLettersFromEnv(a.cli)
+		if err != nil {
+			a.Logger.Fatalf("Dead letters creation error: %s", err)
+		}
+		a.deadLetters = dl
+	}
+
+	// command store and system topic of commands
+	if a.commands == nil {
+		cs, err := commandsFromEnv()
+		if err != nil {
+			a.Logger.Fatalf("Commands store creation error: %s", err)
+		}
+		a.commands = cs
+	}
+	for _, status := range []CommandStatus{CommandQueued, CommandSent} {
+		ids, err := a.commands.Things(context.Background(), status)
+		if err != nil {
+			a.Logger.Errorf("Undelivered commands find error: %s", err)
+			continue
+		}
+		for _, id := range ids {
+			a.undelivered.add(id)
+		}
+	}
+	go a.commandStage()
+	topic := "i1820/things/+/commands"
+	if group := envy.Get("MQTT_SHARE_GROUP", "i1820-link"); group != "" {
+		topic = fmt.Sprintf("$share/%s/%s", group, topic)
+	}
+	if t := a.cli.Subscribe(topic, 1, a.commandHandler); t.Wait() && t.Error() != nil {
+		a.Logger.Fatalf("MQTT subscribe error: %s", t.Error())
+	}
+
+	// device shadows store
+	if a.shadows == nil {
+		ss, err := shadowsFromEnv()
+		if err != nil {
+			a.Logger.Fatalf("Shadows store creation error: %s", err)
+		}
+		a.shadows = ss
+	}
+
+	// retention policies store and maintenance stages
+	if a.retentions == nil {
+		rs, err := retentionsFromEnv()
+		if err != nil {
+			a.Logger.Fatalf("Retentions store creation error: %s", err)
+		}
+		a.retentions = rs
+	}
+	if len(a.maintainers) > 0 && a.rollupInterval > 0 {
+		go a.rollupStage()
+	}
+	if len(a.maintainers) > 0 && a.retentionInterval > 0 {
+		go a.retentionStage()
+	}
+
+	// rule and alert stores, rules are loaded before the pipeline starts
+	if a.rules == nil {
+		rs, as, err := rulesFromEnv()
+		if err != nil {
+			a.Logger.Fatalf("Rules store creation error: %s", err)
+		}
+		a.rules = rs
+		a.alerts = as
+	}
+	if a.rules != nil {
+		if err := a.reloadRules(context.Background()); err != nil {
+			a.Logger.Errorf("Rules load error: %s", err)
+		}
+		go a.ruleStage()
+		a.runAlerts(a.alertWorkers, a.alertQueueSize)
 	}
-	a.db = a.session.Database("i1820")
 
 	// pipeline stages
-	for i := 0; i < runtime.NumCPU(); i++ {
-		go a.projectStage()
-		go a.decodeStage()
-		go a.insertStage()
-		a.insertCloseCounter.Add(1)
+	workers := runtime.NumCPU()
+	if a.ordered {
+		workers = 1
+	}
+	for _, l := range a.lanes {
+		a.runLane(l, workers)
 	}
 
-	a.IsRun = true
+	// open the write-ahead log, its uncommitted records are replayed
+	if a.walDir != "" {
+		w, err := OpenWAL(a.walDir, a.walSegmentSize, a.walSync)
+		if err != nil {
+			a.Logger.Fatalf("WAL open error: %s", err)
+		}
+		a.wal = w
+		a.walCloseChan = make(chan struct{})
+		p, err := NewFileDeadLetters(filepath.Join(a.walDir, "parked.jsonl"))
+		if err != nil {
+			a.Logger.Fatalf("WAL parked states open error: %s", err)
+		}
+		a.parked = p
+
+		// states must not leave write-ahead log when they cannot be stored anywhere
+		if a.deadLetters == nil {
+			a.insertRetry.MaxAttempts = 0
+		}
+		go a.walStage()
+	}
+
+	// queue depth metrics
+	a.queues = queueCollector{a}
+	if err := prometheus.Register(a.queues); err != nil {
+		a.Logger.Errorf("Queue metrics register error: %s", err)
+	}
+
+	a.runLock.Lock()
+	a.running = true
+	a.runLock.Unlock()
+
+	// states that are parked in the previous runs are replayed after start
+	if a.parked != nil {
+		go a.replayParked()
+	}
+}
+
+// IsRun returns true when application is running and it accepts data
+func (a *Application) IsRun() bool {
+	a.runLock.RLock()
+	defer a.runLock.RUnlock()
+
+	return a.running
 }
 
-// Exit closes mqtt connection then closes all channels and return from all pipeline stages
+// Exit closes all channels and return from all pipeline stages then closes mqtt connection
 func (a *Application) Exit() {
-	a.IsRun = false
+	// wait for in-flight data calls so none of them sends on the closed streams
+	a.runLock.Lock()
+	a.running = false
+	a.runLock.Unlock()
 
-	// disconnect waiting time in milliseconds
-	var quiesce uint = 10
-	a.cli.Disconnect(quiesce)
+	close(a.exitChan)
 
-	// close project stream
-	close(a.projectStream)
+	// stop reading from write-ahead log before closing project stream
+	if a.wal != nil {
+		a.wal.Stop()
+		<-a.walCloseChan
+	}
+
+	// close project streams
+	for _, l := range a.lanes {
+		close(l.projectStream)
+	}
 
 	// all channels are going to close
 	// so we are waiting for them
 	a.insertCloseCounter.Wait()
+
+	// decode stages are returned so there is no more alert
+	a.closeAlerts()
+
+	// materialize rollups of the last inserted states
+	if len(a.maintainers) > 0 && a.rollupInterval > 0 {
+		a.rollup()
+	}
+
+	prometheus.Unregister(a.queues)
+
+	if a.wal != nil {
+		if err := a.wal.Close(); err != nil {
+			a.Logger.Errorf("WAL close error: %s", err)
+		}
+	}
+
+	// disconnect waiting time in milliseconds
+	var quiesce uint = 250
+	a.cli.Disconnect(quiesce)
+}
+
+// ExitContext exits application like Exit but it returns an error
+// when pipeline is not drained before context is done.
+func (a *Application) ExitContext(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		a.Exit()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("Pipeline drain error: %s", ctx.Err())
+	}
+}
+
+// requestIDKey is the context key of request identification
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of given context that carries given request identification.
+// states that are passed into application with this context have it in their pipeline logs.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns request identification of given context
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
 }
 
 // Data sends incoming data into application for futher processing
 // incomming data must have raw, at, thingid and assets section of data
-// please note that this function is a blocking function.
+// please note that this function is a blocking function when overflow mode is block.
 func (a *Application) Data(s types.State) error {
-	if !a.IsRun {
-		return fmt.Errorf("You cann't pass data into application when it is not running")
+	return a.DataContext(context.Background(), s)
+}
+
+// DataContext sends incoming data into application for futher processing
+// it follows the application overflow mode when pipeline queue is full and
+// it returns context error when context is done before data is accepted.
+// when write-ahead log is enabled it only blocks until data is appended into the log.
+func (a *Application) DataContext(ctx context.Context, s types.State) error {
+	a.runLock.RLock()
+	defer a.runLock.RUnlock()
+
+	if !a.running {
+		return ErrNotRunning
 	}
 	if s.Raw == nil || s.At.IsZero() {
 		return fmt.Errorf("Raw and At must not be zero")
@@ -161,6 +640,62 @@ func (a *Application) Data(s types.State) error {
 		return fmt.Errorf("ThingID and Asset must not be empty")
 	}
 
-	a.projectStream <- &s
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if a.wal != nil {
+		if _, err := a.wal.append(walRecord{State: s, RequestID: RequestID(ctx)}); err != nil {
+			return fmt.Errorf("WAL append error: %s", err)
+		}
+		return nil
+	}
+
+	m := &message{State: &s, requestID: RequestID(ctx)}
+	l := a.laneOf(s.ThingID)
+
+	switch a.overflow {
+	case OverflowReject:
+		select {
+		case l.projectStream <- m:
+		default:
+			stageErrors.WithLabelValues("data", "rejected").Inc()
+			return ErrQueueFull
+		}
+	case OverflowDropNewest:
+		select {
+		case l.projectStream <- m:
+		default:
+			a.drop(m)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case l.projectStream <- m:
+				return nil
+			default:
+			}
+
+			select {
+			case o := <-l.projectStream:
+				a.drop(o)
+			default:
+			}
+		}
+	default:
+		select {
+		case l.projectStream <- m:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
 	return nil
 }
+
+// drop drops given message because of pipeline overflow
+func (a *Application) drop(m *message) {
+	stageErrors.WithLabelValues("data", "overflow").Inc()
+	a.Logger.WithFields(m.fields()).Warnf("Drop data because of pipeline overflow (%s)", a.overflow)
+	a.done(m)
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/FANIoT/types"
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,7 +31,10 @@ const aName = "memory" // Asset Name
 const pName = "her"    // Project Name
 
 func TestPipeline(t *testing.T) {
-	a := New()
+	db, err := Database("mongodb://127.0.0.1:27017")
+	assert.NoError(t, err)
+
+	a := New(NewMongoSink(db))
 	a.Run()
 	ts := time.Now()
 
@@ -44,7 +48,7 @@ func TestPipeline(t *testing.T) {
 	a.Exit()
 
 	var d types.State
-	q := a.db.Collection(fmt.Sprintf("data.%s.%s", pName, tID)).FindOne(context.Background(), bson.NewDocument(
+	q := db.Collection(collection(pName, tID)).FindOne(context.Background(), bson.NewDocument(
 		bson.EC.SubDocument("at", bson.NewDocument(
 			bson.EC.Time("$gte", ts),
 		)),
@@ -56,6 +60,85 @@ func TestPipeline(t *testing.T) {
 	assert.Equal(t, 18.20, d.Value.Number)
 }
 
+func TestPipelineMemory(t *testing.T) {
+	s := NewMemorySink()
+
+	a := New(s)
+	a.Run()
+	ts := time.Now()
+
+	assert.NoError(t, a.Data(types.State{
+		Raw:     18.20,
+		At:      ts,
+		Asset:   aName,
+		ThingID: tID,
+		Project: pName,
+	}))
+	a.Exit()
+
+	ss := s.States()
+	assert.Len(t, ss, 1)
+	assert.Equal(t, ts.Unix(), ss[0].At.Unix())
+	assert.Equal(t, 18.20, ss[0].Value.Number)
+}
+
+func TestDataOverflow(t *testing.T) {
+	l := newLane(1)
+	a := &Application{
+		Logger:  logrus.New(),
+		running: true,
+		lanes:   []*lane{l},
+	}
+	s := types.State{
+		Raw:     18.20,
+		At:      time.Now(),
+		Asset:   aName,
+		ThingID: tID,
+	}
+
+	a.overflow = OverflowReject
+	assert.NoError(t, a.Data(s))
+	assert.Equal(t, ErrQueueFull, a.Data(s))
+
+	a.overflow = OverflowDropNewest
+	assert.NoError(t, a.Data(s))
+	assert.Len(t, l.projectStream, 1)
+
+	a.overflow = OverflowDropOldest
+	s.Raw = 10.00
+	assert.NoError(t, a.Data(s))
+	assert.Equal(t, 10.00, (<-l.projectStream).Raw)
+
+	a.overflow = OverflowBlock
+	assert.NoError(t, a.Data(s))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, a.DataContext(ctx, s))
+}
+
+func TestLaneOf(t *testing.T) {
+	a := &Application{
+		lanes: []*lane{newLane(0), newLane(0), newLane(0)},
+	}
+
+	l := a.laneOf(tID)
+	for i := 0; i < 10; i++ {
+		assert.True(t, l == a.laneOf(tID))
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "18.20")
+	assert.Equal(t, "18.20", RequestID(ctx))
+	assert.Equal(t, "", RequestID(context.Background()))
+
+	m := &message{
+		State:     &types.State{ThingID: tID, Asset: aName},
+		requestID: RequestID(ctx),
+	}
+	assert.Equal(t, "18.20", m.fields()["request_id"])
+}
+
 func BenchmarkPipeline(b *testing.B) {
 	a := New()
 	a.Run()
@@ -80,3 +163,30 @@ func BenchmarkPipeline(b *testing.B) {
 		<-wait
 	}
 }
+
+func benchmarkInsert(b *testing.B, size int) {
+	a := New()
+	a.batchSize = size
+	a.Run()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		assert.NoError(b, a.Data(types.State{
+			At:      time.Now(),
+			Raw:     18.20,
+			Asset:   aName,
+			ThingID: tID,
+			Project: pName,
+		}))
+	}
+	// exit flushes all remaining batches
+	a.Exit()
+}
+
+func BenchmarkInsertOne(b *testing.B) {
+	benchmarkInsert(b, 1)
+}
+
+func BenchmarkInsertBatch(b *testing.B) {
+	benchmarkInsert(b, 100)
+}
@@ -0,0 +1,726 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     command.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FANIoT/link/pm"
+	"github.com/FANIoT/types"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gobuffalo/envy"
+	"github.com/mongodb/mongo-go-driver/bson"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
+	"github.com/sirupsen/logrus"
+)
+
+// CommandStatus is a status in command lifecycle
+type CommandStatus string
+
+// Command statuses
+const (
+	CommandQueued  CommandStatus = "queued"  // command is stored and waits for its delivery
+	CommandSent    CommandStatus = "sent"    // command is delivered to device connectivity
+	CommandAcked   CommandStatus = "acked"   // device acknowledges the command
+	CommandExpired CommandStatus = "expired" // command is not acknowledged before its expiration
+)
+
+// Command is a downlink message from platform to a thing.
+// its value is encoded by the thing model into its payload.
+type Command struct {
+	ID           string        `json:"id" bson:"_id"`
+	ThingID      string        `json:"thingid" bson:"thingid"`
+	Project      string        `json:"project" bson:"project"`
+	Value        interface{}   `json:"value" bson:"value"`
+	Payload      []byte        `json:"payload" bson:"payload"`
+	Connectivity string        `json:"connectivity" bson:"connectivity"`
+	Status       CommandStatus `json:"status" bson:"status"`
+	CreatedAt    time.Time     `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at" bson:"updated_at"`
+	ExpiresAt    time.Time     `json:"expires_at" bson:"expires_at"`
+}
+
+// CommandRequest is a command that is requested by applications.
+// connectivity and time to live are optional.
+type CommandRequest struct {
+	Value        interface{} `json:"value"`
+	Connectivity string      `json:"connectivity"`
+	TTL          string      `json:"ttl"`
+}
+
+// CommandStore stores commands and their statuses
+type CommandStore interface {
+	Put(ctx context.Context, c Command) error
+	Get(ctx context.Context, id string) (Command, error)
+	// List returns the oldest commands of thing with given status or with any status when it is empty
+	List(ctx context.Context, thingID string, status CommandStatus, limit int) ([]Command, error)
+	SetStatus(ctx context.Context, id string, status CommandStatus) error
+	// Expire marks queued and sent commands that are expired before given time
+	Expire(ctx context.Context, now time.Time) (int64, error)
+	// Things returns things that have commands with given status
+	Things(ctx context.Context, status CommandStatus) ([]string, error)
+
+	Name() string
+}
+
+// Deliverer delivers commands to things over a connectivity and returns command status after delivery
+type Deliverer interface {
+	Deliver(ctx context.Context, t types.Thing, c Command) (CommandStatus, error)
+
+	Name() string
+}
+
+// AckedDeliverer is a deliverer that things acknowledge its commands. sent commands of these deliverers
+// are delivered again until they are acknowledged or expired, because being sent does not mean that
+// a thing receives them.
+type AckedDeliverer interface {
+	Deliverer
+
+	AcksCommands()
+}
+
+// commandsFromEnv creates command store based on COMMANDS environment variable
+// that is mongo or memory. it is mongo by default only when states are stored in mongodb.
+func commandsFromEnv() (CommandStore, error) {
+	switch name := envy.Get("COMMANDS", defaultStore()); name {
+	case "mongo":
+		db, err := databaseFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return NewMongoCommands(db), nil
+	case "memory":
+		return NewMemoryCommands(), nil
+	default:
+		return nil, fmt.Errorf("Commands store %s is not supported", name)
+	}
+}
+
+// MongoCommands stores commands in commands collection
+type MongoCommands struct {
+	c *mgo.Collection
+}
+
+// NewMongoCommands creates commands store on given database
+func NewMongoCommands(db *mgo.Database) *MongoCommands {
+	return &MongoCommands{
+		c: db.Collection("commands"),
+	}
+}
+
+// Name returns mongo commands name
+func (*MongoCommands) Name() string {
+	return "mongo"
+}
+
+// Put inserts given command
+func (m *MongoCommands) Put(ctx context.Context, c Command) error {
+	_, err := m.c.InsertOne(ctx, c)
+	return err
+}
+
+// Get finds command by its id
+func (m *MongoCommands) Get(ctx context.Context, id string) (Command, error) {
+	var c Command
+
+	dr := m.c.FindOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", id),
+	))
+	if err := dr.Decode(&c); err != nil {
+		if err == mgo.ErrNoDocuments {
+			return c, fmt.Errorf("Command %s not found", id)
+		}
+		return c, err
+	}
+
+	return c, nil
+}
+
+// List returns the oldest commands of thing
+func (m *MongoCommands) List(ctx context.Context, thingID string, status CommandStatus, limit int) ([]Command, error) {
+	cs := make([]Command, 0)
+
+	filter := bson.NewDocument(
+		bson.EC.String("thingid", thingID),
+	)
+	if status != "" {
+		filter.Append(bson.EC.String("status", string(status)))
+	}
+
+	cur, err := m.c.Find(ctx, filter, findopt.Sort(bson.NewDocument(
+		bson.EC.Int32("created_at", 1),
+	)), findopt.Limit(int64(limit)))
+	if err != nil {
+		return cs, err
+	}
+
+	for cur.Next(ctx) {
+		var c Command
+
+		if err := cur.Decode(&c); err != nil {
+			return cs, err
+		}
+
+		cs = append(cs, c)
+	}
+	if err := cur.Close(ctx); err != nil {
+		return cs, err
+	}
+
+	return cs, nil
+}
+
+// SetStatus updates status of command
+func (m *MongoCommands) SetStatus(ctx context.Context, id string, status CommandStatus) error {
+	r, err := m.c.UpdateOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", id),
+	), bson.NewDocument(
+		bson.EC.SubDocumentFromElements("$set",
+			bson.EC.String("status", string(status)),
+			bson.EC.DateTime("updated_at", time.Now().UnixNano()/int64(time.Millisecond)),
+		),
+	))
+	if err != nil {
+		return err
+	}
+	if r.MatchedCount == 0 {
+		return fmt.Errorf("Command %s not found", id)
+	}
+	return nil
+}
+
+// Expire marks queued and sent commands that are expired before given time
+func (m *MongoCommands) Expire(ctx context.Context, now time.Time) (int64, error) {
+	ms := now.UnixNano() / int64(time.Millisecond)
+
+	r, err := m.c.UpdateMany(ctx, bson.NewDocument(
+		bson.EC.SubDocumentFromElements("status",
+			bson.EC.ArrayFromElements("$in", bson.VC.String(string(CommandQueued)), bson.VC.String(string(CommandSent))),
+		),
+		bson.EC.SubDocumentFromElements("expires_at",
+			bson.EC.DateTime("$lte", ms),
+		),
+	), bson.NewDocument(
+		bson.EC.SubDocumentFromElements("$set",
+			bson.EC.String("status", string(CommandExpired)),
+			bson.EC.DateTime("updated_at", ms),
+		),
+	))
+	if err != nil {
+		return 0, err
+	}
+	return r.ModifiedCount, nil
+}
+
+// Things returns things that have commands with given status
+func (m *MongoCommands) Things(ctx context.Context, status CommandStatus) ([]string, error) {
+	vs, err := m.c.Distinct(ctx, "thingid", bson.NewDocument(
+		bson.EC.String("status", string(status)),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(vs))
+	for _, v := range vs {
+		if id, ok := v.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// MemoryCommands stores commands in memory
+type MemoryCommands struct {
+	commands map[string]Command
+	lock     sync.RWMutex
+}
+
+// NewMemoryCommands creates an empty memory command store
+func NewMemoryCommands() *MemoryCommands {
+	return &MemoryCommands{
+		commands: make(map[string]Command),
+	}
+}
+
+// Name returns memory commands name
+func (*MemoryCommands) Name() string {
+	return "memory"
+}
+
+// Put stores given command
+func (m *MemoryCommands) Put(_ context.Context, c Command) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.commands[c.ID] = c
+	return nil
+}
+
+// Get finds command by its id
+func (m *MemoryCommands) Get(_ context.Context, id string) (Command, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	c, ok := m.commands[id]
+	if !ok {
+		return c, fmt.Errorf("Command %s not found", id)
+	}
+	return c, nil
+}
+
+// List returns the oldest commands of thing
+func (m *MemoryCommands) List(_ context.Context, thingID string, status CommandStatus, limit int) ([]Command, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	cs := make([]Command, 0)
+	for _, c := range m.commands {
+		if c.ThingID == thingID && (status == "" || c.Status == status) {
+			cs = append(cs, c)
+		}
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		return cs[i].CreatedAt.Before(cs[j].CreatedAt)
+	})
+	if limit > 0 && len(cs) > limit {
+		cs = cs[:limit]
+	}
+	return cs, nil
+}
+
+// SetStatus updates status of command
+func (m *MemoryCommands) SetStatus(_ context.Context, id string, status CommandStatus) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	c, ok := m.commands[id]
+	if !ok {
+		return fmt.Errorf("Command %s not found", id)
+	}
+	c.Status = status
+	c.UpdatedAt = time.Now()
+	m.commands[id] = c
+	return nil
+}
+
+// Expire marks queued and sent commands that are expired before given time
+func (m *MemoryCommands) Expire(_ context.Context, now time.Time) (int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var n int64
+	for id, c := range m.commands {
+		if (c.Status == CommandQueued || c.Status == CommandSent) && !c.ExpiresAt.After(now) {
+			c.Status = CommandExpired
+			c.UpdatedAt = now
+			m.commands[id] = c
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Things returns things that have commands with given status
+func (m *MemoryCommands) Things(_ context.Context, status CommandStatus) ([]string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	set := make(map[string]bool)
+	for _, c := range m.commands {
+		if c.Status == status {
+			set[c.ThingID] = true
+		}
+	}
+
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// thingSet is a concurrent set of things
+type thingSet struct {
+	things map[string]struct{}
+	lock   sync.RWMutex
+}
+
+// newThingSet creates an empty set of things
+func newThingSet() *thingSet {
+	return &thingSet{
+		things: make(map[string]struct{}),
+	}
+}
+
+// add adds thing into the set
+func (s *thingSet) add(thingID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.things[thingID] = struct{}{}
+}
+
+// has checks the set has thing
+func (s *thingSet) has(thingID string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	_, ok := s.things[thingID]
+	return ok
+}
+
+// take removes thing from the set and returns true when the set had it
+func (s *thingSet) take(thingID string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, ok := s.things[thingID]
+	delete(s.things, thingID)
+	return ok
+}
+
+// pollingDeliverer keeps commands queued so devices poll them over http
+type pollingDeliverer struct{}
+
+// Name returns http polling connectivity name
+func (pollingDeliverer) Name() string {
+	return "http"
+}
+
+// Deliver keeps command in the queue
+func (pollingDeliverer) Deliver(context.Context, types.Thing, Command) (CommandStatus, error) {
+	return CommandQueued, nil
+}
+
+// RegisterDeliverer makes a connectivity available for delivering commands.
+// deliverers with the same name replace each other.
+func (a *Application) RegisterDeliverer(d Deliverer) {
+	a.deliverersLock.Lock()
+	defer a.deliverersLock.Unlock()
+
+	a.deliverers[d.Name()] = d
+}
+
+// delivererOf returns the deliverer of command. it uses requested connectivity and then
+// the first connectivity of thing that has a deliverer and then the default connectivity.
+func (a *Application) delivererOf(t types.Thing, connectivity string) (Deliverer, error) {
+	a.deliverersLock.RLock()
+	defer a.deliverersLock.RUnlock()
+
+	if connectivity != "" {
+		d, ok := a.deliverers[connectivity]
+		if !ok {
+			return nil, fmt.Errorf("Connectivity %s is not supported", connectivity)
+		}
+		return d, nil
+	}
+
+	names := make([]string, 0, len(t.Connectivities))
+	for name := range t.Connectivities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if d, ok := a.deliverers[name]; ok {
+			return d, nil
+		}
+	}
+
+	d, ok := a.deliverers[a.connectivity]
+	if !ok {
+		return nil, fmt.Errorf("Connectivity %s is not supported", a.connectivity)
+	}
+	return d, nil
+}
+
+// encode encodes command value with thing model. things without model have json payloads.
+func (a *Application) encode(ctx context.Context, thingID string, value interface{}) ([]byte, error) {
+	m, err := a.modelOf(ctx, thingID)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return json.Marshal(value)
+	}
+
+	b := m.Encode(value)
+	if b == nil {
+		return nil, fmt.Errorf("Model %s cannot encode %v", m.Name(), value)
+	}
+	return b, nil
+}
+
+// Command encodes requested command with the thing model then stores and delivers it
+func (a *Application) Command(ctx context.Context, thingID string, r CommandRequest) (Command, error) {
+	ttl := a.commandTTL
+	if r.TTL != "" {
+		d, err := time.ParseDuration(r.TTL)
+		if err != nil {
+			return Command{}, fmt.Errorf("Invalid ttl: %s", err)
+		}
+		ttl = d
+	}
+
+	t, err := pm.ThingByID(ctx, thingID)
+	if err != nil {
+		return Command{}, err
+	}
+
+	d, err := a.delivererOf(t, r.Connectivity)
+	if err != nil {
+		return Command{}, err
+	}
+
+	b, err := a.encode(ctx, thingID, r.Value)
+	if err != nil {
+		return Command{}, err
+	}
+
+	now := time.Now()
+	c := Command{
+		ID:           newID(),
+		ThingID:      thingID,
+		Project:      t.Project,
+		Value:        r.Value,
+		Payload:      b,
+		Connectivity: d.Name(),
+		Status:       CommandQueued,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		ExpiresAt:    now.Add(ttl),
+	}
+	if err := a.commands.Put(ctx, c); err != nil {
+		return c, err
+	}
+
+	return a.deliver(ctx, t, d, c)
+}
+
+// deliver delivers queued command and updates its status. commands that are not delivered
+// stay queued and they are delivered again when their thing appears.
+func (a *Application) deliver(ctx context.Context, t types.Thing, d Deliverer, c Command) (Command, error) {
+	status, err := d.Deliver(ctx, t, c)
+	if err != nil {
+		a.Logger.WithFields(logrus.Fields{
+			"component":    "link",
+			"thingid":      c.ThingID,
+			"command":      c.ID,
+			"connectivity": c.Connectivity,
+		}).Errorf("Command delivery error: %s", err)
+		a.undelivered.add(c.ThingID)
+		return c, nil
+	}
+	if status != c.Status {
+		if err := a.commands.SetStatus(ctx, c.ID, status); err != nil {
+			return c, err
+		}
+		c.Status = status
+	}
+	// sent commands are delivered again until their acknowledgement
+	if _, acked := d.(AckedDeliverer); acked && status == CommandSent {
+		a.undelivered.add(c.ThingID)
+	}
+
+	return c, nil
+}
+
+// Redeliver delivers queued commands of thing again when their previous delivery has failed,
+// it also delivers sent commands again when their connectivity acknowledges them and they are not acknowledged yet.
+// connectivities and pipeline call it when things appear and commands that are expired
+// are marked instead of delivery.
+func (a *Application) Redeliver(ctx context.Context, thingID string) error {
+	if !a.undelivered.take(thingID) {
+		return nil
+	}
+
+	cs := make([]Command, 0)
+	for _, status := range []CommandStatus{CommandQueued, CommandSent} {
+		scs, err := a.commands.List(ctx, thingID, status, 0)
+		if err != nil {
+			a.undelivered.add(thingID)
+			return err
+		}
+		cs = append(cs, scs...)
+	}
+	if len(cs) == 0 {
+		return nil
+	}
+
+	t, err := pm.ThingByID(ctx, thingID)
+	if err != nil {
+		a.undelivered.add(thingID)
+		return err
+	}
+
+	now := time.Now()
+	for _, c := range cs {
+		if !c.ExpiresAt.After(now) {
+			if err := a.commands.SetStatus(ctx, c.ID, CommandExpired); err != nil {
+				return err
+			}
+			continue
+		}
+
+		a.deliverersLock.RLock()
+		d, ok := a.deliverers[c.Connectivity]
+		a.deliverersLock.RUnlock()
+		// polled commands are queued until their things poll them
+		if _, polled := d.(pollingDeliverer); !ok || polled {
+			continue
+		}
+		// sent commands are delivered again only when their connectivity acknowledges them
+		if _, acked := d.(AckedDeliverer); c.Status == CommandSent && !acked {
+			continue
+		}
+
+		if _, err := a.deliver(ctx, t, d, c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Commands returns the oldest commands of thing
+func (a *Application) Commands(ctx context.Context, thingID string, limit int) ([]Command, error) {
+	return a.commands.List(ctx, thingID, "", limit)
+}
+
+// CommandByID finds command of thing by its id
+func (a *Application) CommandByID(ctx context.Context, thingID string, id string) (Command, error) {
+	c, err := a.commands.Get(ctx, id)
+	if err != nil {
+		return c, err
+	}
+	if c.ThingID != thingID {
+		return Command{}, fmt.Errorf("Command %s not found", id)
+	}
+	return c, nil
+}
+
+// PollCommands returns queued commands of thing and marks them as sent.
+// commands that are expired are marked as expired instead.
+func (a *Application) PollCommands(ctx context.Context, thingID string, limit int) ([]Command, error) {
+	qs, err := a.commands.List(ctx, thingID, CommandQueued, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cs := make([]Command, 0, len(qs))
+	for _, c := range qs {
+		status := CommandSent
+		if !c.ExpiresAt.After(now) {
+			status = CommandExpired
+		}
+		if err := a.commands.SetStatus(ctx, c.ID, status); err != nil {
+			return nil, err
+		}
+		if status == CommandSent {
+			c.Status = status
+			cs = append(cs, c)
+		}
+	}
+
+	return cs, nil
+}
+
+// AckCommand marks command of thing as acknowledged
+func (a *Application) AckCommand(ctx context.Context, thingID string, id string) error {
+	c, err := a.CommandByID(ctx, thingID, id)
+	if err != nil {
+		return err
+	}
+	if c.Status == CommandExpired {
+		return fmt.Errorf("Command %s is expired", id)
+	}
+
+	return a.commands.SetStatus(ctx, id, CommandAcked)
+}
+
+// redeliver delivers queued commands of thing again and logs its errors
+func (a *Application) redeliver(thingID string) {
+	if err := a.Redeliver(context.Background(), thingID); err != nil {
+		a.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"thingid":   thingID,
+		}).Errorf("Command redelivery error: %s", err)
+	}
+}
+
+// commandStage expires commands periodically
+func (a *Application) commandStage() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n, err := a.commands.Expire(context.Background(), time.Now())
+			if err != nil {
+				a.Logger.WithFields(logrus.Fields{
+					"component": "link",
+				}).Errorf("Command expire error: %s", err)
+				continue
+			}
+			if n > 0 {
+				a.Logger.WithFields(logrus.Fields{
+					"component": "link",
+				}).Infof("%d commands are expired", n)
+			}
+		case <-a.exitChan:
+			return
+		}
+	}
+}
+
+// commandHandler handles commands on the following system topic
+// i1820/things/{thing_id}/commands
+func (a *Application) commandHandler(client paho.Client, message paho.Message) {
+	levels := strings.Split(message.Topic(), "/")
+	thingID := levels[len(levels)-2]
+
+	var r CommandRequest
+	if err := json.Unmarshal(message.Payload(), &r); err != nil {
+		a.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"topic":     message.Topic(),
+		}).Errorf("Command unmarshal error %s: %s", err, message.Payload())
+		return
+	}
+
+	c, err := a.Command(context.Background(), thingID, r)
+	if err != nil {
+		a.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"topic":     message.Topic(),
+		}).Errorf("Command error: %s", err)
+		return
+	}
+
+	a.Logger.WithFields(logrus.Fields{
+		"component": "link",
+		"thingid":   thingID,
+		"command":   c.ID,
+	}).Infof("Command is %s", c.Status)
+}
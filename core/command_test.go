@@ -0,0 +1,158 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     command_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCommands(t *testing.T) {
+	cs := NewMemoryCommands()
+	a := &Application{
+		commands: cs,
+	}
+	ctx := context.Background()
+	now := time.Now()
+
+	assert.NoError(t, cs.Put(ctx, Command{ID: "1", ThingID: tID, Status: CommandQueued, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}))
+	assert.NoError(t, cs.Put(ctx, Command{ID: "0", ThingID: tID, Status: CommandQueued, CreatedAt: now.Add(-time.Second), ExpiresAt: now.Add(time.Hour)}))
+	assert.NoError(t, cs.Put(ctx, Command{ID: "2", ThingID: tID, Status: CommandSent, CreatedAt: now, ExpiresAt: now.Add(-time.Second)}))
+
+	polled, err := a.PollCommands(ctx, tID, 10)
+	assert.NoError(t, err)
+	assert.Len(t, polled, 2)
+	assert.Equal(t, "0", polled[0].ID)
+	assert.Equal(t, CommandSent, polled[0].Status)
+
+	polled, err = a.PollCommands(ctx, tID, 10)
+	assert.NoError(t, err)
+	assert.Len(t, polled, 0)
+
+	assert.NoError(t, a.AckCommand(ctx, tID, "0"))
+	assert.Error(t, a.AckCommand(ctx, "18.20", "1"))
+
+	n, err := cs.Expire(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Error(t, a.AckCommand(ctx, tID, "2"))
+
+	c, err := a.CommandByID(ctx, tID, "0")
+	assert.NoError(t, err)
+	assert.Equal(t, CommandAcked, c.Status)
+}
+
+func TestDelivererOf(t *testing.T) {
+	a := &Application{
+		deliverers: map[string]Deliverer{
+			"http": pollingDeliverer{},
+		},
+		connectivity: "mqtt",
+	}
+
+	_, err := a.delivererOf(types.Thing{}, "")
+	assert.Error(t, err)
+
+	d, err := a.delivererOf(types.Thing{}, "http")
+	assert.NoError(t, err)
+	assert.Equal(t, "http", d.Name())
+
+	d, err = a.delivererOf(types.Thing{Connectivities: map[string]interface{}{"http": nil}}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "http", d.Name())
+
+	_, err = a.delivererOf(types.Thing{}, "lora")
+	assert.Error(t, err)
+}
+
+func TestUndeliveredCommands(t *testing.T) {
+	cs := NewMemoryCommands()
+	a := &Application{
+		commands:    cs,
+		undelivered: newThingSet(),
+	}
+	ctx := context.Background()
+	now := time.Now()
+
+	assert.NoError(t, cs.Put(ctx, Command{ID: "0", ThingID: tID, Status: CommandQueued, CreatedAt: now, ExpiresAt: now.Add(-time.Second)}))
+	assert.NoError(t, cs.Put(ctx, Command{ID: "1", ThingID: "18.20", Status: CommandAcked, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}))
+
+	ids, err := cs.Things(ctx, CommandQueued)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{tID}, ids)
+
+	// things without undelivered commands are skipped
+	assert.NoError(t, a.Redeliver(ctx, tID))
+
+	// expired commands are not polled
+	polled, err := a.PollCommands(ctx, tID, 10)
+	assert.NoError(t, err)
+	assert.Len(t, polled, 0)
+	c, err := a.CommandByID(ctx, tID, "0")
+	assert.NoError(t, err)
+	assert.Equal(t, CommandExpired, c.Status)
+
+	a.undelivered.add(tID)
+	assert.True(t, a.undelivered.has(tID))
+	assert.True(t, a.undelivered.take(tID))
+	assert.False(t, a.undelivered.take(tID))
+}
+
+// ackedDeliverer sends commands and its things acknowledge them
+type ackedDeliverer struct{}
+
+func (ackedDeliverer) Name() string {
+	return "mqtt"
+}
+
+func (ackedDeliverer) Deliver(context.Context, types.Thing, Command) (CommandStatus, error) {
+	return CommandSent, nil
+}
+
+func (ackedDeliverer) AcksCommands() {}
+
+func TestSentCommands(t *testing.T) {
+	cs := NewMemoryCommands()
+	a := &Application{
+		commands:    cs,
+		undelivered: newThingSet(),
+	}
+	ctx := context.Background()
+	now := time.Now()
+
+	c := Command{ID: "0", ThingID: tID, Status: CommandQueued, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	assert.NoError(t, cs.Put(ctx, c))
+
+	// sent commands wait for their acknowledgement
+	c, err := a.deliver(ctx, types.Thing{ID: tID}, ackedDeliverer{}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, CommandSent, c.Status)
+	assert.True(t, a.undelivered.take(tID))
+
+	ids, err := cs.Things(ctx, CommandSent)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{tID}, ids)
+
+	// commands of deliverers without acknowledgement are not delivered again
+	c.ID = "1"
+	c.Status = CommandQueued
+	assert.NoError(t, cs.Put(ctx, c))
+	_, err = a.deliver(ctx, types.Thing{ID: tID}, pollingDeliverer{}, c)
+	assert.NoError(t, err)
+	assert.False(t, a.undelivered.has(tID))
+}
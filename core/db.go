@@ -0,0 +1,72 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     db.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gobuffalo/envy"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+)
+
+// databases has one connected client for each mongodb url so mongo sink
+// and all of the mongo stores share their connections
+var databases = struct {
+	m map[string]*mgo.Database
+	sync.Mutex
+}{
+	m: make(map[string]*mgo.Database),
+}
+
+// Database returns i1820 database on given mongodb url. it creates and connects
+// mongodb client on the first call for each url.
+func Database(url string) (*mgo.Database, error) {
+	databases.Lock()
+	defer databases.Unlock()
+
+	if db, ok := databases.m[url]; ok {
+		return db, nil
+	}
+
+	session, err := mgo.NewClient(url)
+	if err != nil {
+		return nil, fmt.Errorf("DB new client error: %s", err)
+	}
+	if err := session.Connect(context.Background()); err != nil {
+		return nil, fmt.Errorf("DB connection error: %s", err)
+	}
+
+	db := session.Database("i1820")
+	databases.m[url] = db
+	return db, nil
+}
+
+// databaseFromEnv returns i1820 database on DB_URL environment variable
+func databaseFromEnv() (*mgo.Database, error) {
+	return Database(envy.Get("DB_URL", "mongodb://127.0.0.1:27017"))
+}
+
+// defaultStore returns mongo when states are stored in mongodb and memory otherwise
+// so stores use mongodb by default only when there is a mongodb.
+func defaultStore() string {
+	for _, name := range strings.Split(envy.Get("SINKS", "mongo"), ",") {
+		if strings.TrimSpace(name) == "mongo" {
+			return "mongo"
+		}
+	}
+	return "memory"
+}
@@ -0,0 +1,462 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     deadletter.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/FANIoT/types"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gobuffalo/envy"
+	"github.com/mongodb/mongo-go-driver/bson"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
+	"github.com/sirupsen/logrus"
+)
+
+// DeadLetter is a state that pipeline cannot process after all of its retries
+type DeadLetter struct {
+	ID    string      `json:"id" bson:"_id"`
+	State types.State `json:"state" bson:"state"`
+	Stage string      `json:"stage" bson:"stage"`
+	Error string      `json:"error" bson:"error"`
+	At    time.Time   `json:"at" bson:"at"`
+
+	// Binary is true when raw payload of state is binary, json encodes it
+	// as base64 string so it must be decoded on reading.
+	Binary bool `json:"binary" bson:"binary"`
+}
+
+// DeadLetters is a destination for dead letters
+type DeadLetters interface {
+	Put(ctx context.Context, l DeadLetter) error
+
+	Name() string
+}
+
+// DeadLetterStore is a dead letters destination that can be read,
+// so its dead letters can be re-injected into the pipeline.
+type DeadLetterStore interface {
+	DeadLetters
+
+	List(ctx context.Context, limit int) ([]DeadLetter, error)
+	Get(ctx context.Context, id string) (DeadLetter, error)
+	Remove(ctx context.Context, id string) error
+}
+
+// deadLettersFromEnv creates dead letters destination based on DEADLETTERS environment variable
+// that is one of mongo, file or mqtt. it returns nil when DEADLETTERS is empty.
+func deadLettersFromEnv(cli paho.Client) (DeadLetters, error) {
+	switch name := envy.Get("DEADLETTERS", ""); name {
+	case "":
+		return nil, nil
+	case "mongo":
+		db, err := databaseFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return NewMongoDeadLetters(db), nil
+	case "file":
+		return NewFileDeadLetters(envy.Get("DEADLETTERS_FILE_PATH", "deadletters.jsonl"))
+	case "mqtt":
+		return NewMQTTDeadLetters(cli, envy.Get("DEADLETTERS_TOPIC", "i1820/deadletters")), nil
+	default:
+		return nil, fmt.Errorf("Dead letters %s is not supported", name)
+	}
+}
+
+// newID creates a random identification for dead letters and commands
+func newID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// MongoDeadLetters stores dead letters in deadletters collection
+type MongoDeadLetters struct {
+	c *mgo.Collection
+}
+
+// NewMongoDeadLetters creates dead letters store on given database
+func NewMongoDeadLetters(db *mgo.Database) *MongoDeadLetters {
+	return &MongoDeadLetters{
+		c: db.Collection("deadletters"),
+	}
+}
+
+// Name returns mongo dead letters name
+func (*MongoDeadLetters) Name() string {
+	return "mongo"
+}
+
+// Put inserts given dead letter
+func (m *MongoDeadLetters) Put(ctx context.Context, l DeadLetter) error {
+	_, err := m.c.InsertOne(ctx, l)
+	return err
+}
+
+// List returns the oldest dead letters
+func (m *MongoDeadLetters) List(ctx context.Context, limit int) ([]DeadLetter, error) {
+	ls := make([]DeadLetter, 0)
+
+	cur, err := m.c.Find(ctx, bson.NewDocument(), findopt.Sort(bson.NewDocument(
+		bson.EC.Int32("at", 1),
+	)), findopt.Limit(int64(limit)))
+	if err != nil {
+		return ls, err
+	}
+
+	for cur.Next(ctx) {
+		var l DeadLetter
+
+		if err := cur.Decode(&l); err != nil {
+			return ls, err
+		}
+
+		ls = append(ls, l)
+	}
+	if err := cur.Close(ctx); err != nil {
+		return ls, err
+	}
+
+	return ls, nil
+}
+
+// Get finds dead letter by its id
+func (m *MongoDeadLetters) Get(ctx context.Context, id string) (DeadLetter, error) {
+	var l DeadLetter
+
+	dr := m.c.FindOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", id),
+	))
+	if err := dr.Decode(&l); err != nil {
+		if err == mgo.ErrNoDocuments {
+			return l, fmt.Errorf("Dead letter %s not found", id)
+		}
+		return l, err
+	}
+
+	return l, nil
+}
+
+// Remove removes dead letter by its id
+func (m *MongoDeadLetters) Remove(ctx context.Context, id string) error {
+	_, err := m.c.DeleteOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", id),
+	))
+	return err
+}
+
+// FileDeadLetters appends dead letters into a file as json lines
+type FileDeadLetters struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewFileDeadLetters creates file dead letters on given path. file is created if it does not exist.
+func NewFileDeadLetters(path string) (*FileDeadLetters, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	return &FileDeadLetters{
+		path: path,
+	}, nil
+}
+
+// Name returns file dead letters name
+func (*FileDeadLetters) Name() string {
+	return "file"
+}
+
+// Put appends given dead letter into file
+func (f *FileDeadLetters) Put(_ context.Context, l DeadLetter) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	fd, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(append(b, '\n')); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// all reads all dead letters of file
+func (f *FileDeadLetters) all() ([]DeadLetter, error) {
+	ls := make([]DeadLetter, 0)
+
+	b, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return ls, err
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var l DeadLetter
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			return ls, err
+		}
+		if r, ok := l.State.Raw.(string); ok && l.Binary {
+			b, err := base64.StdEncoding.DecodeString(r)
+			if err != nil {
+				return ls, err
+			}
+			l.State.Raw = b
+		}
+		ls = append(ls, l)
+	}
+
+	return ls, sc.Err()
+}
+
+// List returns the oldest dead letters
+func (f *FileDeadLetters) List(_ context.Context, limit int) ([]DeadLetter, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	ls, err := f.all()
+	if err != nil {
+		return ls, err
+	}
+	if limit > 0 && len(ls) > limit {
+		ls = ls[:limit]
+	}
+	return ls, nil
+}
+
+// Get finds dead letter by its id
+func (f *FileDeadLetters) Get(_ context.Context, id string) (DeadLetter, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	ls, err := f.all()
+	if err != nil {
+		return DeadLetter{}, err
+	}
+	for _, l := range ls {
+		if l.ID == id {
+			return l, nil
+		}
+	}
+	return DeadLetter{}, fmt.Errorf("Dead letter %s not found", id)
+}
+
+// Remove rewrites the file without the given dead letter
+func (f *FileDeadLetters) Remove(_ context.Context, id string) error {
+	return f.remove(map[string]bool{id: true})
+}
+
+// remove rewrites the file without the given dead letters
+func (f *FileDeadLetters) remove(ids map[string]bool) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	ls, err := f.all()
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, l := range ls {
+		if ids[l.ID] {
+			continue
+		}
+		if err := enc.Encode(l); err != nil {
+			return err
+		}
+	}
+
+	tmp := fmt.Sprintf("%s.tmp", f.path)
+	if err := ioutil.WriteFile(tmp, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+// MQTTDeadLetters publishes dead letters on a topic. consider that they cannot be re-injected.
+type MQTTDeadLetters struct {
+	cli   paho.Client
+	topic string
+}
+
+// NewMQTTDeadLetters creates mqtt dead letters on given topic
+func NewMQTTDeadLetters(cli paho.Client, topic string) *MQTTDeadLetters {
+	return &MQTTDeadLetters{
+		cli:   cli,
+		topic: topic,
+	}
+}
+
+// Name returns mqtt dead letters name
+func (*MQTTDeadLetters) Name() string {
+	return "mqtt"
+}
+
+// Put publishes given dead letter
+func (m *MQTTDeadLetters) Put(_ context.Context, l DeadLetter) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	if t := m.cli.Publish(m.topic, 1, false, b); t.Wait() && t.Error() != nil {
+		return t.Error()
+	}
+	return nil
+}
+
+// deadLetter stores given state as a dead letter of given stage.
+// state is dropped when application does not have any dead letters destination.
+func (a *Application) deadLetter(s types.State, stage string, reason error) error {
+	stageErrors.WithLabelValues(stage, "deadletter").Inc()
+
+	if a.deadLetters == nil {
+		return fmt.Errorf("state is dropped because there is no dead letters destination")
+	}
+
+	_, binary := s.Raw.([]byte)
+	return a.deadLetters.Put(context.Background(), DeadLetter{
+		ID:     newID(),
+		State:  s,
+		Stage:  stage,
+		Error:  reason.Error(),
+		At:     time.Now(),
+		Binary: binary,
+	})
+}
+
+// park stores given state beside write-ahead log when it cannot be dead lettered so its record
+// can be committed. it returns false when state is not parked.
+func (a *Application) park(s types.State, stage string, reason error) bool {
+	if a.parked == nil {
+		return false
+	}
+
+	_, binary := s.Raw.([]byte)
+	if err := a.parked.Put(context.Background(), DeadLetter{
+		ID:     newID(),
+		State:  s,
+		Stage:  stage,
+		Error:  reason.Error(),
+		At:     time.Now(),
+		Binary: binary,
+	}); err != nil {
+		a.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"asset":     s.Asset,
+			"thingid":   s.ThingID,
+		}).Errorf("Park error: %s", err)
+		return false
+	}
+
+	stageErrors.WithLabelValues(stage, "parked").Inc()
+	return true
+}
+
+// replayParked passes the parked states into the pipeline again. it runs on start so states that are
+// parked while their destinations are down are not lost. states that are not accepted stay parked.
+func (a *Application) replayParked() {
+	logger := a.Logger.WithFields(logrus.Fields{
+		"component": "link",
+	})
+
+	ls, err := a.parked.List(context.Background(), 0)
+	if err != nil {
+		logger.Errorf("Parked states read error: %s", err)
+		return
+	}
+
+	replayed := make(map[string]bool)
+	for _, l := range ls {
+		if err := a.Data(l.State); err != nil {
+			logger.Errorf("Parked state replay error: %s", err)
+			break
+		}
+		replayed[l.ID] = true
+	}
+	if len(replayed) == 0 {
+		return
+	}
+
+	if err := a.parked.remove(replayed); err != nil {
+		logger.Errorf("Parked states remove error: %s", err)
+		return
+	}
+	logger.Infof("%d parked states are replayed", len(replayed))
+}
+
+// deadLetterStore returns dead letters destination when it can be read
+func (a *Application) deadLetterStore() (DeadLetterStore, error) {
+	ds, ok := a.deadLetters.(DeadLetterStore)
+	if !ok {
+		return nil, fmt.Errorf("dead letters destination cannot be read")
+	}
+	return ds, nil
+}
+
+// DeadLetters returns the oldest dead letters
+func (a *Application) DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	ds, err := a.deadLetterStore()
+	if err != nil {
+		return nil, err
+	}
+	return ds.List(ctx, limit)
+}
+
+// Reinject passes the given dead letter into the pipeline again and then removes it
+func (a *Application) Reinject(ctx context.Context, id string) error {
+	ds, err := a.deadLetterStore()
+	if err != nil {
+		return err
+	}
+
+	l, err := ds.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := a.Data(l.State); err != nil {
+		return err
+	}
+
+	return ds.Remove(ctx, id)
+}
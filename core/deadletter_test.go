@@ -0,0 +1,104 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     deadletter_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileDeadLetters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "link")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	d, err := NewFileDeadLetters(filepath.Join(dir, "deadletters.jsonl"))
+	assert.NoError(t, err)
+
+	a := &Application{deadLetters: d}
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, a.deadLetter(types.State{
+			Raw:     []byte{18, 20},
+			At:      time.Now(),
+			Asset:   aName,
+			ThingID: tID,
+		}, "insert", os.ErrClosed))
+	}
+
+	ls, err := a.DeadLetters(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, ls, 2)
+	assert.Equal(t, "insert", ls[0].Stage)
+	assert.Equal(t, []byte{18, 20}, ls[0].State.Raw)
+
+	assert.NoError(t, d.Remove(context.Background(), ls[0].ID))
+
+	_, err = d.Get(context.Background(), ls[0].ID)
+	assert.Error(t, err)
+	l, err := d.Get(context.Background(), ls[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, ls[1].ID, l.ID)
+}
+
+func TestPark(t *testing.T) {
+	dir, err := ioutil.TempDir("", "link")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a := &Application{}
+	s := types.State{
+		Raw:     18.20,
+		At:      time.Now(),
+		Asset:   aName,
+		ThingID: tID,
+	}
+
+	// states are not parked without write-ahead log
+	assert.False(t, a.park(s, "insert", os.ErrClosed))
+
+	p, err := NewFileDeadLetters(filepath.Join(dir, "parked.jsonl"))
+	assert.NoError(t, err)
+	a.parked = p
+
+	assert.Error(t, a.deadLetter(s, "insert", os.ErrClosed))
+	assert.True(t, a.park(s, "insert", os.ErrClosed))
+
+	ls, err := p.List(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, ls, 1)
+	assert.Equal(t, "insert", ls[0].Stage)
+
+	// parked states are replayed until pipeline rejects them
+	assert.True(t, a.park(s, "insert", os.ErrClosed))
+	l := newLane(1)
+	a.Logger = logrus.New()
+	a.lanes = []*lane{l}
+	a.running = true
+	a.overflow = OverflowReject
+	a.replayParked()
+	assert.Len(t, l.projectStream, 1)
+
+	ls, err = p.List(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, ls, 1)
+}
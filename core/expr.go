@@ -0,0 +1,326 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     expr.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode"
+)
+
+// maxExpressionLength is the maximum length of virtual asset expressions
+const maxExpressionLength = 1024
+
+// functions are the functions that expressions can call with their number of arguments.
+// variadic functions have -1 arguments.
+var functions = map[string]struct {
+	args int
+	fn   func(args ...float64) float64
+}{
+	"abs":   {1, func(a ...float64) float64 { return math.Abs(a[0]) }},
+	"sqrt":  {1, func(a ...float64) float64 { return math.Sqrt(a[0]) }},
+	"log":   {1, func(a ...float64) float64 { return math.Log(a[0]) }},
+	"log10": {1, func(a ...float64) float64 { return math.Log10(a[0]) }},
+	"exp":   {1, func(a ...float64) float64 { return math.Exp(a[0]) }},
+	"round": {1, func(a ...float64) float64 { return math.Round(a[0]) }},
+	"pow":   {2, func(a ...float64) float64 { return math.Pow(a[0], a[1]) }},
+	"min": {-1, func(a ...float64) float64 {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	}},
+	"max": {-1, func(a ...float64) float64 {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	}},
+}
+
+// expression is a compiled arithmetic expression on asset values like `voltage * current`.
+// expressions have numbers, assets, + - * / % ^ operators, parentheses and math functions
+// and they cannot run anything else so they are safe to evaluate on each state.
+type expression struct {
+	root node
+	vars []string
+}
+
+// node is a node of expression syntax tree
+type node func(vars map[string]float64) float64
+
+// compileExpression parses given expression
+func compileExpression(e string) (*expression, error) {
+	if len(e) > maxExpressionLength {
+		return nil, fmt.Errorf("Expression is longer than %d characters", maxExpressionLength)
+	}
+
+	tokens, err := tokenize(e)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		tokens: tokens,
+		vars:   make(map[string]bool),
+	}
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("Unexpected %q in expression", p.tokens[p.pos])
+	}
+
+	vars := make([]string, 0, len(p.vars))
+	for v := range p.vars {
+		vars = append(vars, v)
+	}
+	sort.Strings(vars)
+
+	return &expression{
+		root: root,
+		vars: vars,
+	}, nil
+}
+
+// assets returns sorted assets of expression
+func (e *expression) assets() []string {
+	return e.vars
+}
+
+// eval evaluates expression with given asset values. all of the expression assets
+// must have value and the result must be a finite number.
+func (e *expression) eval(vars map[string]float64) (float64, error) {
+	for _, v := range e.vars {
+		if _, ok := vars[v]; !ok {
+			return 0, fmt.Errorf("Asset %s does not have any value", v)
+		}
+	}
+
+	v := e.root(vars)
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("Expression result %g is not a finite number", v)
+	}
+	return v, nil
+}
+
+// tokenize splits expression into numbers, identifiers and operators
+func tokenize(e string) ([]string, error) {
+	tokens := make([]string, 0)
+
+	rs := []rune(e)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, string(rs[i:j]))
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_' || rs[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, string(rs[i:j]))
+			i = j
+		case r == '+' || r == '-' || r == '*' || r == '/' || r == '%' || r == '^' || r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, string(r))
+			i++
+		default:
+			return nil, fmt.Errorf("Unexpected %q in expression", r)
+		}
+	}
+
+	return tokens, nil
+}
+
+// parser is a recursive descent parser of expressions
+type parser struct {
+	tokens []string
+	pos    int
+	vars   map[string]bool
+}
+
+// peek returns the current token or an empty string at the end of expression
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// expr parses additions and subtractions
+func (p *parser) expr() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == "+" || op == "-"; op = p.peek() {
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+
+		l, r := left, right
+		if op == "+" {
+			left = func(vars map[string]float64) float64 { return l(vars) + r(vars) }
+		} else {
+			left = func(vars map[string]float64) float64 { return l(vars) - r(vars) }
+		}
+	}
+	return left, nil
+}
+
+// term parses multiplications, divisions and remainders
+func (p *parser) term() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == "*" || op == "/" || op == "%"; op = p.peek() {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		l, r := left, right
+		switch op {
+		case "*":
+			left = func(vars map[string]float64) float64 { return l(vars) * r(vars) }
+		case "/":
+			left = func(vars map[string]float64) float64 { return l(vars) / r(vars) }
+		case "%":
+			left = func(vars map[string]float64) float64 { return math.Mod(l(vars), r(vars)) }
+		}
+	}
+	return left, nil
+}
+
+// unary parses negations
+func (p *parser) unary() (node, error) {
+	if p.peek() == "-" {
+		p.pos++
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(vars map[string]float64) float64 { return -n(vars) }, nil
+	}
+	return p.power()
+}
+
+// power parses right associative powers
+func (p *parser) power() (node, error) {
+	base, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek() != "^" {
+		return base, nil
+	}
+	p.pos++
+	exp, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return func(vars map[string]float64) float64 { return math.Pow(base(vars), exp(vars)) }, nil
+}
+
+// primary parses numbers, assets, function calls and parentheses
+func (p *parser) primary() (node, error) {
+	t := p.peek()
+	if t == "" {
+		return nil, fmt.Errorf("Unexpected end of expression")
+	}
+	p.pos++
+
+	switch r := []rune(t)[0]; {
+	case t == "(":
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("Missing ) in expression")
+		}
+		p.pos++
+		return n, nil
+	case unicode.IsDigit(r) || r == '.':
+		v, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid number %q in expression", t)
+		}
+		return func(map[string]float64) float64 { return v }, nil
+	case unicode.IsLetter(r) || r == '_':
+		if p.peek() == "(" {
+			return p.call(t)
+		}
+		p.vars[t] = true
+		return func(vars map[string]float64) float64 { return vars[t] }, nil
+	}
+
+	return nil, fmt.Errorf("Unexpected %q in expression", t)
+}
+
+// call parses arguments of function call
+func (p *parser) call(name string) (node, error) {
+	f, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("Function %s is not supported", name)
+	}
+	p.pos++ // (
+
+	args := make([]node, 0)
+	for p.peek() != ")" {
+		if len(args) > 0 {
+			if p.peek() != "," {
+				return nil, fmt.Errorf("Missing , in %s arguments", name)
+			}
+			p.pos++
+		}
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, n)
+	}
+	p.pos++ // )
+
+	if (f.args >= 0 && len(args) != f.args) || len(args) == 0 {
+		return nil, fmt.Errorf("Function %s has invalid number of arguments", name)
+	}
+
+	return func(vars map[string]float64) float64 {
+		values := make([]float64, len(args))
+		for i, a := range args {
+			values[i] = a(vars)
+		}
+		return f.fn(values...)
+	}, nil
+}
@@ -0,0 +1,74 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     file.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/FANIoT/types"
+)
+
+// FileSink appends states into a file as json lines
+type FileSink struct {
+	f    *os.File
+	lock sync.Mutex
+}
+
+// NewFileSink opens given file for appending states. file is created if it does not exist.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSink{
+		f: f,
+	}, nil
+}
+
+// Name returns file sink name
+func (*FileSink) Name() string {
+	return "file"
+}
+
+// Insert appends given states into file, one json document per line.
+// states are written with a single write so a batch is not interleaved with others.
+func (f *FileSink) Insert(_ context.Context, states []types.State) error {
+	var b bytes.Buffer
+
+	enc := json.NewEncoder(&b)
+	for _, s := range states {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	_, err := f.f.Write(b.Bytes())
+	return err
+}
+
+// Close closes sink file
+func (f *FileSink) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.f.Close()
+}
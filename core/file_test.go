@@ -0,0 +1,58 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     file_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "link")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileSink(filepath.Join(dir, "link.jsonl"))
+	assert.NoError(t, err)
+
+	ts := time.Now()
+	assert.NoError(t, s.Insert(context.Background(), []types.State{
+		{At: ts, Asset: aName, ThingID: tID, Project: pName},
+		{At: ts, Asset: aName, ThingID: tID, Project: pName},
+	}))
+	assert.NoError(t, s.Close())
+
+	f, err := os.Open(filepath.Join(dir, "link.jsonl"))
+	assert.NoError(t, err)
+	defer f.Close()
+
+	n := 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var d types.State
+		assert.NoError(t, json.Unmarshal(sc.Bytes(), &d))
+		assert.Equal(t, tID, d.ThingID)
+		n++
+	}
+	assert.Equal(t, 2, n)
+}
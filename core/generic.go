@@ -0,0 +1,275 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     generic.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"fmt"
+	"runtime/metrics"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/sirupsen/logrus"
+)
+
+// GenericModelName is a name that things use for selecting generic model.
+// these things must have a decode script.
+const GenericModelName = "generic"
+
+// Generic is a model that runs user scripts with an embedded javascript interpreter.
+// Script must define a `decode` function that accepts payload as an array of bytes and returns
+// an object that maps asset names into their values. it can also define an `encode` function that
+// accepts a value and returns an array of bytes.
+// Each run happens in a fresh interpreter and it is interrupted when it takes more than Timeout
+// or when it grows the heap more than MemoryLimit.
+type Generic struct {
+	name    string
+	script  string
+	program *goja.Program
+
+	Timeout time.Duration
+	// MaxPayloadSize limits the size of decode payloads and encode results in bytes
+	MaxPayloadSize int
+	// MaxAssets limits the number of assets that decode returns
+	MaxAssets int
+	// MaxCallStackSize limits the recursion depth of scripts
+	MaxCallStackSize int
+	// MemoryLimit limits the heap growth of each run in bytes
+	MemoryLimit int
+
+	Logger *logrus.Logger
+}
+
+// NewGeneric compiles given script and creates a generic model
+func NewGeneric(name string, script string) (*Generic, error) {
+	p, err := goja.Compile(name, script, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Generic{
+		name:    name,
+		script:  script,
+		program: p,
+
+		Timeout:          100 * time.Millisecond,
+		MaxPayloadSize:   64 * 1024,
+		MaxAssets:        256,
+		MaxCallStackSize: 256,
+		MemoryLimit:      32 * 1024 * 1024,
+
+		Logger: logrus.StandardLogger(),
+	}, nil
+}
+
+// Name returns generic model name
+func (g *Generic) Name() string {
+	return g.name
+}
+
+// Script returns the script of generic model
+func (g *Generic) Script() string {
+	return g.script
+}
+
+// Decode runs script decode function on given payload.
+// it returns nil when script fails.
+func (g *Generic) Decode(b []byte) interface{} {
+	if len(b) > g.MaxPayloadSize {
+		g.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"model":     g.name,
+		}).Errorf("Script decode payload has %d bytes that is more than %d", len(b), g.MaxPayloadSize)
+		return nil
+	}
+
+	payload := make([]interface{}, len(b))
+	for i, v := range b {
+		payload[i] = int64(v)
+	}
+
+	v, err := g.call("decode", payload)
+	if err != nil {
+		g.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"model":     g.name,
+		}).Errorf("Script decode error: %s", err)
+		return nil
+	}
+
+	o, ok := v.(map[string]interface{})
+	if !ok {
+		g.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"model":     g.name,
+		}).Errorf("Script decode must return an object instead of %T", v)
+		return nil
+	}
+	if len(o) > g.MaxAssets {
+		g.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"model":     g.name,
+		}).Errorf("Script decode returns %d assets that is more than %d", len(o), g.MaxAssets)
+		return nil
+	}
+
+	return Assets(o)
+}
+
+// Encode runs script encode function on given value.
+// it returns nil when script fails or it does not have an encode function.
+func (g *Generic) Encode(value interface{}) []byte {
+	v, err := g.call("encode", value)
+	if err != nil {
+		g.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"model":     g.name,
+		}).Errorf("Script encode error: %s", err)
+		return nil
+	}
+
+	a, ok := v.([]interface{})
+	if !ok {
+		g.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"model":     g.name,
+		}).Errorf("Script encode must return an array instead of %T", v)
+		return nil
+	}
+	if len(a) > g.MaxPayloadSize {
+		g.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"model":     g.name,
+		}).Errorf("Script encode returns %d bytes that is more than %d", len(a), g.MaxPayloadSize)
+		return nil
+	}
+
+	b := make([]byte, len(a))
+	for i, e := range a {
+		switch n := e.(type) {
+		case int64:
+			b[i] = byte(n)
+		case float64:
+			b[i] = byte(n)
+		default:
+			g.Logger.WithFields(logrus.Fields{
+				"component": "link",
+				"model":     g.name,
+			}).Errorf("Script encode returns %T at %d instead of a byte", e, i)
+			return nil
+		}
+	}
+
+	return b
+}
+
+// call runs script in a fresh interpreter and then calls the given function of it.
+// interpreter is interrupted when it reaches the time or the memory limit.
+func (g *Generic) call(fn string, arg interface{}) (interface{}, error) {
+	vm := goja.New()
+	vm.SetMaxCallStackSize(g.MaxCallStackSize)
+	g.guard(vm)
+
+	done := make(chan struct{})
+	defer close(done)
+	go g.watch(vm, done)
+
+	if _, err := vm.RunProgram(g.program); err != nil {
+		return nil, err
+	}
+
+	f, ok := goja.AssertFunction(vm.Get(fn))
+	if !ok {
+		return nil, fmt.Errorf("script does not have %s function", fn)
+	}
+
+	v, err := f(goja.Undefined(), vm.ToValue(arg))
+	if err != nil {
+		return nil, err
+	}
+
+	return v.Export(), nil
+}
+
+// heapMetric is the runtime metric that watch uses. it is read without stopping the world.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// watch interrupts the interpreter when it runs more than Timeout or when heap grows
+// more than MemoryLimit since its start. heap is shared between all goroutines so this limit
+// is a budget for the whole run and not an exact accounting of the script allocations.
+func (g *Generic) watch(vm *goja.Runtime, done <-chan struct{}) {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	base := sample[0].Value.Uint64()
+
+	timeout := time.NewTimer(g.Timeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-timeout.C:
+			vm.Interrupt(fmt.Sprintf("script runs more than %s", g.Timeout))
+			return
+		case <-ticker.C:
+			metrics.Read(sample)
+			if heap := sample[0].Value.Uint64(); heap > base && heap-base > uint64(g.MemoryLimit) {
+				vm.Interrupt(fmt.Sprintf("script allocates more than %d bytes", g.MemoryLimit))
+				return
+			}
+		}
+	}
+}
+
+// guard replaces the string builtins that allocate their whole result in one step,
+// so they cannot be interrupted by watch, with versions that check the result size first.
+func (g *Generic) guard(vm *goja.Runtime) {
+	proto := vm.Get("String").ToObject(vm).Get("prototype").ToObject(vm)
+
+	for _, name := range []string{"repeat", "padStart", "padEnd"} {
+		name := name
+		builtin, ok := goja.AssertFunction(proto.Get(name))
+		if !ok {
+			continue
+		}
+
+		proto.Set(name, func(call goja.FunctionCall) goja.Value {
+			if goja.IsUndefined(call.This) || goja.IsNull(call.This) {
+				panic(vm.NewTypeError("String.prototype.%s called on null or undefined", name))
+			}
+			s := call.This.String()
+			n := call.Argument(0).ToInteger()
+
+			size := n
+			if name == "repeat" {
+				size = int64(len(s)) * n
+			}
+			if n > int64(g.MemoryLimit) || size > int64(g.MemoryLimit) {
+				panic(vm.NewGoError(fmt.Errorf("%s result is more than %d bytes", name, g.MemoryLimit)))
+			}
+
+			args := []goja.Value{vm.ToValue(n)}
+			if name != "repeat" && !goja.IsUndefined(call.Argument(1)) {
+				args = append(args, vm.ToValue(call.Argument(1).String()))
+			}
+			v, err := builtin(vm.ToValue(s), args...)
+			if err != nil {
+				panic(err)
+			}
+			return v
+		})
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     generic_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const script = `
+function decode(payload) {
+	return {
+		temperature: (payload[0] << 8 | payload[1]) / 100,
+		on: payload[2] === 1,
+	};
+}
+
+function encode(value) {
+	return [value ? 1 : 0];
+}
+`
+
+func TestGeneric(t *testing.T) {
+	g, err := NewGeneric("aolab", script)
+	assert.NoError(t, err)
+
+	v := g.Decode([]byte{0x07, 0x1C, 0x01})
+	assert.Equal(t, Assets{
+		"temperature": 18.2,
+		"on":          true,
+	}, v)
+
+	assert.Equal(t, []byte{1}, g.Encode(true))
+}
+
+func TestGenericTimeout(t *testing.T) {
+	g, err := NewGeneric("loop", "function decode(payload) { while (true) {} }")
+	assert.NoError(t, err)
+	g.Timeout = 50 * time.Millisecond
+
+	now := time.Now()
+	assert.Nil(t, g.Decode([]byte{1}))
+	assert.True(t, time.Since(now) < time.Second)
+}
+
+func TestGenericLimits(t *testing.T) {
+	g, err := NewGeneric("limits", `
+	function decode(payload) {
+		var o = {};
+		for (var i = 0; i < payload.length; i++) {
+			o["a" + i] = payload[i];
+		}
+		return o;
+	}
+	function encode(value) {
+		var a = [];
+		for (var i = 0; i < value; i++) {
+			a.push(i);
+		}
+		return a;
+	}`)
+	assert.NoError(t, err)
+	g.MaxPayloadSize = 4
+	g.MaxAssets = 2
+
+	assert.NotNil(t, g.Decode([]byte{1, 2}))
+	assert.Nil(t, g.Decode([]byte{1, 2, 3}))
+	assert.Nil(t, g.Decode([]byte{1, 2, 3, 4, 5}))
+
+	assert.Len(t, g.Encode(4), 4)
+	assert.Nil(t, g.Encode(5))
+}
+
+func TestGenericMemory(t *testing.T) {
+	g, err := NewGeneric("memory", `
+	function decode(payload) {
+		return {"padding": "x".repeat(1 << 28)};
+	}
+	function encode(value) {
+		var a = [];
+		for (;;) {
+			a.push({"value": value});
+		}
+	}`)
+	assert.NoError(t, err)
+	g.Timeout = 10 * time.Second
+	g.MemoryLimit = 1024 * 1024
+
+	_, err = g.call("decode", []interface{}{})
+	assert.Error(t, err)
+	assert.Nil(t, g.Decode([]byte{1}))
+
+	start := time.Now()
+	_, err = g.call("encode", 1)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < g.Timeout)
+
+	// guarded builtins still work within the limit
+	g, err = NewGeneric("padding", `
+	function decode(payload) {
+		return {"padding": "ab".repeat(2) + "1".padStart(3, "0") + "1".padEnd(2)};
+	}`)
+	assert.NoError(t, err)
+	assert.Equal(t, Assets{"padding": "abab0011 "}, g.Decode([]byte{1}))
+}
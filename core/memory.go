@@ -0,0 +1,113 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     memory.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FANIoT/types"
+)
+
+// MemorySink keeps states in memory. it is useful for tests
+// and running pipeline without any database.
+type MemorySink struct {
+	states []types.State
+	lock   sync.RWMutex
+}
+
+// NewMemorySink creates an empty memory sink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{
+		states: make([]types.State, 0),
+	}
+}
+
+// Name returns memory sink name
+func (*MemorySink) Name() string {
+	return "memory"
+}
+
+// Insert appends given states into memory
+func (m *MemorySink) Insert(_ context.Context, states []types.State) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.states = append(m.states, states...)
+	return nil
+}
+
+// States returns a copy of stored states in their insertion order
+func (m *MemorySink) States() []types.State {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	ss := make([]types.State, len(m.states))
+	copy(ss, m.states)
+	return ss
+}
+
+// Latest returns the latest state of each asset of thing
+func (m *MemorySink) Latest(_ context.Context, project string, thingID string, asset string) ([]types.State, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	latest := make(map[string]types.State)
+	for _, s := range m.states {
+		if s.Project != project || s.ThingID != thingID || (asset != "" && s.Asset != asset) {
+			continue
+		}
+		if l, ok := latest[s.Asset]; !ok || !s.At.Before(l.At) {
+			latest[s.Asset] = s
+		}
+	}
+
+	ss := make([]types.State, 0, len(latest))
+	for _, s := range latest {
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+// Range returns states of thing asset in the given time range sorted by their time.
+// states with the same time keep their insertion order.
+func (m *MemorySink) Range(_ context.Context, project string, thingID string, asset string, from time.Time, to time.Time, skip int, limit int) ([]types.State, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	ss := make([]types.State, 0)
+	for _, s := range m.states {
+		if s.Project != project || s.ThingID != thingID || s.Asset != asset {
+			continue
+		}
+		if s.At.Before(from) || (!to.IsZero() && !s.At.Before(to)) {
+			continue
+		}
+		ss = append(ss, s)
+	}
+	sort.SliceStable(ss, func(i, j int) bool {
+		return ss[i].At.Before(ss[j].At)
+	})
+
+	if skip >= len(ss) {
+		return ss[:0], nil
+	}
+	ss = ss[skip:]
+	if limit > 0 && len(ss) > limit {
+		ss = ss[:limit]
+	}
+	return ss, nil
+}
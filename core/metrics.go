@@ -0,0 +1,171 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     metrics.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pipeline prometheus collectors, they are registered on the default registry
+// so they are served on link /metrics endpoint.
+var (
+	// stage counters do not have project label because projects are unbounded,
+	// per project counts are in the capped project_states_total.
+	statesIn = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "link",
+			Subsystem: "pipeline",
+			Name:      "states_in_total",
+			Help:      "How many states are entered into each stage",
+		},
+		[]string{"stage"},
+	)
+
+	statesOut = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "link",
+			Subsystem: "pipeline",
+			Name:      "states_out_total",
+			Help:      "How many states are passed successfully from each stage",
+		},
+		[]string{"stage"},
+	)
+
+	stageErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "link",
+			Subsystem: "pipeline",
+			Name:      "errors_total",
+			Help:      "How many errors are happened in each stage by their reason",
+		},
+		[]string{"stage", "reason"},
+	)
+
+	stageDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "link",
+			Subsystem: "pipeline",
+			Name:      "stage_duration_seconds",
+			Help:      "A histogram of latencies for processing a state in each stage.",
+		},
+		[]string{"stage"},
+	)
+
+	sinkDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "link",
+			Subsystem: "pipeline",
+			Name:      "sink_insert_duration_seconds",
+			Help:      "A histogram of latencies for inserting a batch into each sink.",
+		},
+		[]string{"sink"},
+	)
+
+	// per thing and per project ingestion counters are opt-in
+	thingStates = newCappedCounter(
+		prometheus.CounterOpts{
+			Namespace: "link",
+			Subsystem: "ingestion",
+			Name:      "thing_states_total",
+			Help:      "How many states are ingested from each thing",
+		},
+		"thing",
+	)
+
+	projectStates = newCappedCounter(
+		prometheus.CounterOpts{
+			Namespace: "link",
+			Subsystem: "ingestion",
+			Name:      "project_states_total",
+			Help:      "How many states are ingested into each project",
+		},
+		"project",
+	)
+
+	queueDepth = prometheus.NewDesc(
+		"link_pipeline_queue_depth",
+		"Number of states that are waiting in each stream of pipeline lanes",
+		[]string{"stream", "lane"},
+		nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(statesIn, statesOut, stageErrors, stageDuration, sinkDuration)
+	prometheus.MustRegister(thingStates.vec, projectStates.vec)
+}
+
+// otherLabel is used instead of label values that are seen after the cap
+const otherLabel = "other"
+
+// cappedCounter is a counter with one label that has at most limit distinct values,
+// values after the limit are counted as otherLabel so they cannot blow up prometheus.
+type cappedCounter struct {
+	vec *prometheus.CounterVec
+
+	lock sync.Mutex
+	seen map[string]struct{}
+}
+
+func newCappedCounter(opts prometheus.CounterOpts, label string) *cappedCounter {
+	return &cappedCounter{
+		vec:  prometheus.NewCounterVec(opts, []string{label}),
+		seen: make(map[string]struct{}),
+	}
+}
+
+// inc increments counter of given value when it is seen before or there is room for it
+func (c *cappedCounter) inc(value string, limit int) {
+	c.lock.Lock()
+	if _, ok := c.seen[value]; !ok {
+		if len(c.seen) < limit {
+			c.seen[value] = struct{}{}
+		} else {
+			value = otherLabel
+		}
+	}
+	c.lock.Unlock()
+
+	c.vec.WithLabelValues(value).Inc()
+}
+
+// observe observes the duration of given stage from the given start time
+func observe(stage string, start time.Time) {
+	stageDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+// queueCollector collects depth of application streams
+type queueCollector struct {
+	a *Application
+}
+
+// Describe sends queue depth descriptor
+func (q queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepth
+}
+
+// Collect sends the current depth of each stream
+func (q queueCollector) Collect(ch chan<- prometheus.Metric) {
+	for i, l := range q.a.lanes {
+		lane := strconv.Itoa(i)
+
+		ch <- prometheus.MustNewConstMetric(queueDepth, prometheus.GaugeValue, float64(len(l.projectStream)), "project", lane)
+		ch <- prometheus.MustNewConstMetric(queueDepth, prometheus.GaugeValue, float64(len(l.decodeStream)), "decode", lane)
+		ch <- prometheus.MustNewConstMetric(queueDepth, prometheus.GaugeValue, float64(len(l.insertStream)), "insert", lane)
+	}
+}
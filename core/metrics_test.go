@@ -0,0 +1,80 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     metrics_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueCollector(t *testing.T) {
+	l := newLane(2)
+	l.projectStream <- &message{}
+	l.insertStream <- &message{}
+	l.insertStream <- &message{}
+
+	a := &Application{
+		lanes: []*lane{l},
+	}
+
+	ch := make(chan prometheus.Metric, 3)
+	queueCollector{a}.Collect(ch)
+	close(ch)
+
+	depths := make(map[string]float64)
+	for m := range ch {
+		var d dto.Metric
+		assert.NoError(t, m.Write(&d))
+
+		var stream string
+		for _, p := range d.GetLabel() {
+			if p.GetName() == "stream" {
+				stream = p.GetValue()
+			}
+		}
+		depths[stream] = d.GetGauge().GetValue()
+	}
+
+	assert.Equal(t, map[string]float64{
+		"project": 1,
+		"decode":  0,
+		"insert":  2,
+	}, depths)
+}
+
+func TestCappedCounter(t *testing.T) {
+	c := newCappedCounter(prometheus.CounterOpts{
+		Name: "capped_total",
+		Help: "capped counter",
+	}, "thing")
+
+	c.inc("0", 2)
+	c.inc("1", 2)
+	c.inc("2", 2)
+	c.inc("3", 2)
+	c.inc("0", 2)
+
+	value := func(label string) float64 {
+		var d dto.Metric
+		assert.NoError(t, c.vec.WithLabelValues(label).Write(&d))
+		return d.GetCounter().GetValue()
+	}
+
+	assert.Equal(t, 2.0, value("0"))
+	assert.Equal(t, 1.0, value("1"))
+	assert.Equal(t, 2.0, value(otherLabel))
+}
@@ -13,6 +13,14 @@
 
 package core
 
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/FANIoT/link/pm"
+)
+
 // Model is a decoder/encoder interface.
 // It specifies a way for creating useful information
 // from raw data that are coming from devices.
@@ -23,3 +31,91 @@ type Model interface {
 
 	Name() string
 }
+
+// Assets is a special decode result. Models return it when a single raw payload
+// carries values of many assets, so decode stage creates a state for each of them.
+type Assets map[string]interface{}
+
+// models holds registered models by their name
+var models = struct {
+	sync.RWMutex
+	m map[string]Model
+}{
+	m: make(map[string]Model),
+}
+
+// RegisterModel makes a model available by its name so things can select it.
+// If RegisterModel is called twice with the same name or if model is nil, it panics.
+func RegisterModel(m Model) {
+	models.Lock()
+	defer models.Unlock()
+
+	if m == nil {
+		panic("core: RegisterModel model is nil")
+	}
+	if _, dup := models.m[m.Name()]; dup {
+		panic(fmt.Sprintf("core: RegisterModel called twice for model %s", m.Name()))
+	}
+	models.m[m.Name()] = m
+}
+
+// ModelByName returns registered model with given name
+func ModelByName(name string) (Model, bool) {
+	models.RLock()
+	defer models.RUnlock()
+
+	m, ok := models.m[name]
+	return m, ok
+}
+
+// modelOf finds the model that is selected by given thing.
+// it returns nil model for things without any model so they use the default decoding.
+// things with generic model have their own script so each of them has a dedicated model.
+func (a *Application) modelOf(ctx context.Context, thingID string) (Model, error) {
+	t, err := pm.ThingByID(ctx, thingID)
+	if err != nil {
+		return nil, err
+	}
+	if t.Model == "" {
+		return nil, nil
+	}
+
+	if t.Model == GenericModelName {
+		return a.genericOf(ctx, thingID)
+	}
+
+	m, ok := ModelByName(t.Model)
+	if !ok {
+		return nil, fmt.Errorf("Model %s of thing %s is not registered", t.Model, thingID)
+	}
+	return m, nil
+}
+
+// genericOf returns generic model of given thing. it compiles thing script
+// only when it is changed.
+func (a *Application) genericOf(ctx context.Context, thingID string) (*Generic, error) {
+	script, err := pm.ScriptByThingID(ctx, thingID)
+	if err != nil {
+		return nil, err
+	}
+
+	a.genericsLock.Lock()
+	defer a.genericsLock.Unlock()
+
+	if g, ok := a.generics[thingID]; ok && g.Script() == script {
+		return g, nil
+	}
+
+	g, err := NewGeneric(fmt.Sprintf("%s-%s", GenericModelName, thingID), script)
+	if err != nil {
+		return nil, fmt.Errorf("Script of thing %s is not valid: %s", thingID, err)
+	}
+	g.Timeout = a.scriptTimeout
+	g.MaxPayloadSize = a.scriptPayloadLimit
+	g.MaxAssets = a.scriptAssetsLimit
+	g.MemoryLimit = a.scriptMemoryLimit
+	g.Logger = a.Logger
+
+	a.generics[thingID] = g
+	return g, nil
+}
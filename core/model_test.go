@@ -0,0 +1,88 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     model_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"testing"
+
+	"github.com/FANIoT/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// byteModel decodes each byte of payload as an asset
+type byteModel struct{}
+
+func (byteModel) Decode(b []byte) interface{} {
+	as := make(Assets)
+	for i, v := range b {
+		as[string('a'+rune(i))] = v
+	}
+	return as
+}
+
+func (byteModel) Encode(interface{}) []byte {
+	return nil
+}
+
+func (byteModel) Name() string {
+	return "byte"
+}
+
+func TestRegisterModel(t *testing.T) {
+	// the test model is removed so the registry is clean on the next run
+	defer func() {
+		models.Lock()
+		delete(models.m, "byte")
+		models.Unlock()
+	}()
+
+	RegisterModel(byteModel{})
+
+	m, ok := ModelByName("byte")
+	assert.True(t, ok)
+	assert.Equal(t, "byte", m.Name())
+
+	assert.Panics(t, func() {
+		RegisterModel(byteModel{})
+	})
+
+	_, ok = ModelByName("aolab")
+	assert.False(t, ok)
+}
+
+func TestFillValue(t *testing.T) {
+	var d types.State
+
+	fillValue(&d, uint8(18))
+	assert.Equal(t, 18.0, d.Value.Number)
+
+	fillValue(&d, []interface{}{1, 2})
+	assert.Equal(t, []interface{}{1, 2}, d.Value.Array)
+
+	fillValue(&d, map[string]interface{}{"on": true})
+	assert.Equal(t, map[string]interface{}{"on": true}, d.Value.Object)
+}
+
+func TestDecodeString(t *testing.T) {
+	a := &Application{}
+
+	// string values are not payloads so they are not decoded by thing model
+	ss, err := a.decode(&message{
+		State: &types.State{ThingID: tID, Asset: aName, Raw: "18.20"},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, ss, 1) {
+		assert.Equal(t, "18.20", ss[0].Value.String)
+	}
+}
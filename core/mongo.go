@@ -0,0 +1,414 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     mongo.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/mongodb/mongo-go-driver/bson"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/aggregateopt"
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
+	"github.com/mongodb/mongo-go-driver/mongo/insertopt"
+	"github.com/mongodb/mongo-go-driver/mongo/replaceopt"
+)
+
+// MongoSink stores states in mongodb. each thing has its own collection
+// with following name data.{project_id}.{thing_id}
+type MongoSink struct {
+	db *mgo.Database
+
+	// collections that have their indexes
+	indexed sync.Map
+}
+
+// NewMongoSink creates sink on given database
+func NewMongoSink(db *mgo.Database) *MongoSink {
+	return &MongoSink{
+		db: db,
+	}
+}
+
+// Name returns mongo sink name
+func (*MongoSink) Name() string {
+	return "mongo"
+}
+
+// stateDocument is a state with its deterministic identification
+type stateDocument struct {
+	ID          string `bson:"_id"`
+	types.State `bson:",inline"`
+}
+
+// stateID returns deterministic identification of state so inserting a state
+// again does not duplicate it.
+func stateID(s types.State) string {
+	raw, _ := json.Marshal(s.Raw)
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%s", s.ThingID, s.Asset, s.At.UnixNano(), raw)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// duplicated returns true when all of the insert errors are duplicate key errors
+func duplicated(err error) bool {
+	bwe, ok := err.(mgo.BulkWriteError)
+	if !ok || bwe.WriteConcernError != nil || len(bwe.WriteErrors) == 0 {
+		return false
+	}
+	for _, we := range bwe.WriteErrors {
+		if we.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
+
+// Insert inserts given states into their thing collections. states have deterministic identifications
+// so retrying a batch after its partial failure does not duplicate the inserted ones.
+func (m *MongoSink) Insert(ctx context.Context, states []types.State) error {
+	batches := make(map[string][]interface{})
+	for _, s := range states {
+		c := collection(s.Project, s.ThingID)
+		batches[c] = append(batches[c], stateDocument{
+			ID:    stateID(s),
+			State: s,
+		})
+	}
+
+	for c, b := range batches {
+		m.index(ctx, c)
+		if _, err := m.db.Collection(c).InsertMany(ctx, b, insertopt.Ordered(false)); err != nil && !duplicated(err) {
+			return fmt.Errorf("Mongo Insert into %s: %s", c, err)
+		}
+	}
+
+	return nil
+}
+
+// Latest returns the latest state of each asset of thing from its collection
+func (m *MongoSink) Latest(ctx context.Context, project string, thingID string, asset string) ([]types.State, error) {
+	ss := make([]types.State, 0)
+
+	match := bson.NewDocument()
+	if asset != "" {
+		match.Append(bson.EC.String("asset", asset))
+	}
+
+	cur, err := m.db.Collection(collection(project, thingID)).Aggregate(ctx, bson.NewArray(
+		bson.VC.DocumentFromElements(
+			bson.EC.SubDocument("$match", match),
+		),
+		// sort follows asset and time index so it does not sort states in memory
+		bson.VC.DocumentFromElements(
+			bson.EC.SubDocumentFromElements("$sort",
+				bson.EC.Int32("asset", -1),
+				bson.EC.Int32("at", -1),
+			),
+		),
+		bson.VC.DocumentFromElements(
+			bson.EC.SubDocumentFromElements("$group",
+				bson.EC.String("_id", "$asset"),
+				bson.EC.SubDocumentFromElements("state", bson.EC.String("$first", "$$ROOT")),
+			),
+		),
+	), aggregateopt.AllowDiskUse(true))
+	if err != nil {
+		return ss, err
+	}
+
+	for cur.Next(ctx) {
+		var r struct {
+			State types.State `bson:"state"`
+		}
+
+		if err := cur.Decode(&r); err != nil {
+			return ss, err
+		}
+
+		ss = append(ss, r.State)
+	}
+	if err := cur.Close(ctx); err != nil {
+		return ss, err
+	}
+
+	return ss, nil
+}
+
+// rangeFilter returns filter of thing asset states in the given time range.
+// zero times are open bounds so they are not in the filter.
+func rangeFilter(asset string, from time.Time, to time.Time) *bson.Document {
+	filter := bson.NewDocument(
+		bson.EC.String("asset", asset),
+	)
+
+	at := bson.NewDocument()
+	if !from.IsZero() {
+		at.Append(bson.EC.DateTime("$gte", from.UnixNano()/int64(time.Millisecond)))
+	}
+	if !to.IsZero() {
+		at.Append(bson.EC.DateTime("$lt", to.UnixNano()/int64(time.Millisecond)))
+	}
+	if at.Len() > 0 {
+		filter.Append(bson.EC.SubDocument("at", at))
+	}
+
+	return filter
+}
+
+// Range returns states of thing asset in the given time range sorted by their time.
+// states with the same time are sorted by their identification so pages are stable.
+func (m *MongoSink) Range(ctx context.Context, project string, thingID string, asset string, from time.Time, to time.Time, skip int, limit int) ([]types.State, error) {
+	ss := make([]types.State, 0)
+
+	cur, err := m.db.Collection(collection(project, thingID)).Find(ctx, rangeFilter(asset, from, to), findopt.Sort(bson.NewDocument(
+		bson.EC.Int32("at", 1),
+		bson.EC.Int32("_id", 1),
+	)), findopt.Skip(int64(skip)), findopt.Limit(int64(limit)))
+	if err != nil {
+		return ss, err
+	}
+
+	for cur.Next(ctx) {
+		var s types.State
+
+		if err := cur.Decode(&s); err != nil {
+			return ss, err
+		}
+
+		ss = append(ss, s)
+	}
+	if err := cur.Close(ctx); err != nil {
+		return ss, err
+	}
+
+	return ss, nil
+}
+
+// Aggregate aggregates numeric states of thing asset with an aggregation pipeline.
+// numeric states are matched by their raw type like numeric and bucket of each state
+// is found based on its milliseconds since epoch.
+func (m *MongoSink) Aggregate(ctx context.Context, project string, thingID string, asset string, from time.Time, to time.Time, bucket time.Duration) ([]Bucket, error) {
+	bs := make([]Bucket, 0)
+
+	match := rangeFilter(asset, from, to)
+	match.Append(bson.EC.ArrayFromElements("$or",
+		bson.VC.DocumentFromElements(
+			bson.EC.SubDocumentFromElements("raw", bson.EC.String("$type", "number")),
+		),
+		bson.VC.DocumentFromElements(
+			bson.EC.SubDocumentFromElements("raw", bson.EC.String("$type", "binData")),
+			bson.EC.SubDocumentFromElements("value.number", bson.EC.Boolean("$exists", true)),
+		),
+	))
+
+	// milliseconds since epoch
+	ms := func() *bson.Value {
+		return bson.VC.DocumentFromElements(
+			bson.EC.ArrayFromElements("$subtract", bson.VC.String("$at"), bson.VC.DateTime(0)),
+		)
+	}
+
+	cur, err := m.db.Collection(collection(project, thingID)).Aggregate(ctx, bson.NewArray(
+		bson.VC.DocumentFromElements(
+			bson.EC.SubDocument("$match", match),
+		),
+		bson.VC.DocumentFromElements(
+			bson.EC.SubDocumentFromElements("$sort", bson.EC.Int32("at", 1)),
+		),
+		bson.VC.DocumentFromElements(
+			bson.EC.SubDocumentFromElements("$project",
+				bson.EC.SubDocumentFromElements("bucket",
+					bson.EC.ArrayFromElements("$subtract",
+						ms(),
+						bson.VC.DocumentFromElements(
+							bson.EC.ArrayFromElements("$mod", ms(), bson.VC.Int64(int64(bucket/time.Millisecond))),
+						),
+					),
+				),
+				bson.EC.SubDocumentFromElements("v",
+					bson.EC.ArrayFromElements("$ifNull", bson.VC.String("$value.number"), bson.VC.Int32(0)),
+				),
+			),
+		),
+		bson.VC.DocumentFromElements(
+			bson.EC.SubDocumentFromElements("$group",
+				bson.EC.String("_id", "$bucket"),
+				bson.EC.SubDocumentFromElements("min", bson.EC.String("$min", "$v")),
+				bson.EC.SubDocumentFromElements("max", bson.EC.String("$max", "$v")),
+				bson.EC.SubDocumentFromElements("mean", bson.EC.String("$avg", "$v")),
+				bson.EC.SubDocumentFromElements("count", bson.EC.Int32("$sum", 1)),
+				bson.EC.SubDocumentFromElements("last", bson.EC.String("$last", "$v")),
+			),
+		),
+		bson.VC.DocumentFromElements(
+			bson.EC.SubDocumentFromElements("$sort", bson.EC.Int32("_id", 1)),
+		),
+	))
+	if err != nil {
+		return bs, err
+	}
+
+	for cur.Next(ctx) {
+		var r struct {
+			ID    int64   `bson:"_id"`
+			Min   float64 `bson:"min"`
+			Max   float64 `bson:"max"`
+			Mean  float64 `bson:"mean"`
+			Count int64   `bson:"count"`
+			Last  float64 `bson:"last"`
+		}
+
+		if err := cur.Decode(&r); err != nil {
+			return bs, err
+		}
+
+		bs = append(bs, Bucket{
+			At:    time.Unix(0, r.ID*int64(time.Millisecond)),
+			Min:   r.Min,
+			Max:   r.Max,
+			Mean:  r.Mean,
+			Count: r.Count,
+			Last:  r.Last,
+		})
+	}
+	if err := cur.Close(ctx); err != nil {
+		return bs, err
+	}
+
+	return bs, nil
+}
+
+// index creates asset and time indexes of given collection when this session has not created them.
+// index creation errors are ignored so states are inserted and creation is tried on the next insert.
+func (m *MongoSink) index(ctx context.Context, c string) {
+	if _, ok := m.indexed.Load(c); ok {
+		return
+	}
+
+	if _, err := m.db.Collection(c).Indexes().CreateMany(ctx, []mgo.IndexModel{
+		{
+			Keys: bson.NewDocument(
+				bson.EC.Int32("asset", 1),
+				bson.EC.Int32("at", 1),
+			),
+		},
+		// retention removes states only based on their time
+		{
+			Keys: bson.NewDocument(
+				bson.EC.Int32("at", 1),
+			),
+		},
+	}); err != nil {
+		return
+	}
+	m.indexed.Store(c, true)
+}
+
+// Rollup materializes aggregate of thing asset states in the bucket into the following collection
+// {prefix}.{project_id}.{thing_id}
+// each rollup has its asset and bucket time in its identification.
+func (m *MongoSink) Rollup(ctx context.Context, project string, thingID string, asset string, at time.Time, bucket string) error {
+	d, ok := Buckets[bucket]
+	prefix, rok := Rollups[bucket]
+	if !ok || !rok {
+		return fmt.Errorf("Rollup bucket %s is not supported", bucket)
+	}
+
+	bs, err := m.Aggregate(ctx, project, thingID, asset, at, at.Add(d), d)
+	if err != nil {
+		return err
+	}
+	if len(bs) == 0 {
+		return nil
+	}
+
+	c := fmt.Sprintf("%s.%s.%s", prefix, project, thingID)
+	m.index(ctx, c)
+
+	id := fmt.Sprintf("%s.%d", asset, at.Unix())
+	_, err = m.db.Collection(c).ReplaceOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", id),
+	), rollup{
+		ID:     id,
+		Asset:  asset,
+		Bucket: bs[0],
+	}, replaceopt.Upsert(true))
+	return err
+}
+
+// rollup is a materialized aggregate of an asset
+type rollup struct {
+	ID     string `bson:"_id"`
+	Asset  string `bson:"asset"`
+	Bucket `bson:",inline"`
+}
+
+// Retain removes raw states and rollups that are older than retention of their project.
+// project of each collection is found based on its name.
+func (m *MongoSink) Retain(ctx context.Context, retentionOf func(project string) map[string]time.Duration, now time.Time) (int64, error) {
+	cur, err := m.db.ListCollections(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for cur.Next(ctx) {
+		var c struct {
+			Name string `bson:"name"`
+		}
+		if err := cur.Decode(&c); err != nil {
+			return n, err
+		}
+
+		// {prefix}.{project_id}.{thing_id}
+		parts := strings.SplitN(c.Name, ".", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		r := retentionOf(parts[1])[parts[0]]
+		if r == 0 {
+			continue
+		}
+		m.index(ctx, c.Name)
+
+		dr, err := m.db.Collection(c.Name).DeleteMany(ctx, bson.NewDocument(
+			bson.EC.SubDocumentFromElements("at",
+				bson.EC.DateTime("$lt", now.Add(-r).UnixNano()/int64(time.Millisecond)),
+			),
+		))
+		if err != nil {
+			return n, err
+		}
+		n += dr.DeletedCount
+	}
+	if err := cur.Close(ctx); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// collection returns the collection name of given thing
+func collection(project string, thingID string) string {
+	return fmt.Sprintf("%s.%s.%s", rawPrefix, project, thingID)
+}
@@ -0,0 +1,71 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     mongo_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/mongodb/mongo-go-driver/bson"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateID(t *testing.T) {
+	at := time.Now()
+	s := types.State{Raw: 18.20, At: at, Asset: aName, ThingID: tID}
+
+	assert.Equal(t, stateID(s), stateID(s))
+
+	o := s
+	o.At = at.Add(time.Nanosecond)
+	assert.NotEqual(t, stateID(s), stateID(o))
+
+	o = s
+	o.Raw = 18.21
+	assert.NotEqual(t, stateID(s), stateID(o))
+}
+
+func TestDuplicated(t *testing.T) {
+	assert.True(t, duplicated(mgo.BulkWriteError{
+		WriteErrors: mgo.WriteErrors{{Index: 0, Code: 11000}, {Index: 2, Code: 11000}},
+	}))
+	assert.False(t, duplicated(mgo.BulkWriteError{
+		WriteErrors: mgo.WriteErrors{{Index: 0, Code: 11000}, {Index: 1, Code: 10334}},
+	}))
+	assert.False(t, duplicated(fmt.Errorf("18.20")))
+}
+
+func TestRangeFilter(t *testing.T) {
+	from := time.Unix(1539858000, 0)
+	to := from.Add(time.Hour)
+	ms := func(t time.Time) int64 {
+		return t.UnixNano() / int64(time.Millisecond)
+	}
+
+	// zero times are not bounds
+	assert.True(t, rangeFilter(aName, time.Time{}, time.Time{}).Equal(bson.NewDocument(
+		bson.EC.String("asset", aName),
+	)))
+	assert.True(t, rangeFilter(aName, time.Time{}, to).Equal(bson.NewDocument(
+		bson.EC.String("asset", aName),
+		bson.EC.SubDocumentFromElements("at", bson.EC.DateTime("$lt", ms(to))),
+	)))
+	assert.True(t, rangeFilter(aName, from, to).Equal(bson.NewDocument(
+		bson.EC.String("asset", aName),
+		bson.EC.SubDocumentFromElements("at", bson.EC.DateTime("$gte", ms(from)), bson.EC.DateTime("$lt", ms(to))),
+	)))
+}
@@ -17,15 +17,158 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/FANIoT/link/pm"
 	"github.com/FANIoT/types"
 	"github.com/sirupsen/logrus"
 )
 
+// message is a state that flows through the pipeline.
+// states that are read from write-ahead log have their record.
+type message struct {
+	*types.State
+	record *record
+
+	// identification of the request that has this state, it appears in the pipeline logs
+	requestID string
+}
+
+// fields returns log fields of message
+func (m *message) fields() logrus.Fields {
+	f := logrus.Fields{
+		"component": "link",
+		"asset":     m.Asset,
+		"thingid":   m.ThingID,
+	}
+	if m.requestID != "" {
+		f["request_id"] = m.requestID
+	}
+	return f
+}
+
+// record is a write-ahead log record. it counts its states in the pipeline
+// and it is committed when all of them are inserted or dropped.
+type record struct {
+	seq  uint64
+	refs int32
+}
+
+// lane is a partition of the pipeline with its own channels
+type lane struct {
+	projectStream chan *message
+	decodeStream  chan *message
+	insertStream  chan *message
+}
+
+// newLane creates a lane with given channels capacity
+func newLane(size int) *lane {
+	return &lane{
+		projectStream: make(chan *message, size),
+		decodeStream:  make(chan *message, size),
+		insertStream:  make(chan *message, size),
+	}
+}
+
+// laneOf returns the lane of given thing. things are distributed between lanes
+// based on the hash of their identification.
+func (a *Application) laneOf(thingID string) *lane {
+	if len(a.lanes) == 1 {
+		return a.lanes[0]
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(thingID))
+	return a.lanes[h.Sum32()%uint32(len(a.lanes))]
+}
+
+// runLane runs given number of instances for each stage of the lane.
+// each stage stream is closed when all instances of its previous stage are returned.
+func (a *Application) runLane(l *lane, workers int) {
+	var project, decode sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		project.Add(1)
+		go func() {
+			a.projectStage(l)
+			project.Done()
+		}()
+
+		decode.Add(1)
+		go func() {
+			a.decodeStage(l)
+			decode.Done()
+		}()
+
+		a.insertCloseCounter.Add(1)
+		go a.insertStage(l)
+	}
+
+	go func() {
+		project.Wait()
+		close(l.decodeStream)
+	}()
+	go func() {
+		decode.Wait()
+		close(l.insertStream)
+	}()
+}
+
+// done is called when a message leaves the pipeline
+func (a *Application) done(m *message) {
+	if m.record == nil {
+		return
+	}
+
+	if atomic.AddInt32(&m.record.refs, -1) == 0 {
+		if err := a.wal.Commit(m.record.seq); err != nil {
+			a.Logger.WithFields(logrus.Fields{
+				"component": "link",
+			}).Errorf("WAL commit error: %s", err)
+		}
+	}
+}
+
+// walStage reads states from write-ahead log and passes them into the pipeline
+func (a *Application) walStage() {
+	a.Logger.WithFields(logrus.Fields{
+		"component": "link",
+	}).Info("WAL pipeline stage")
+
+	for {
+		rc, err := a.wal.nextRecord()
+		if err != nil {
+			if err != errWALStopped {
+				a.Logger.WithFields(logrus.Fields{
+					"component": "link",
+				}).Errorf("WAL read error: %s", err)
+			}
+			break
+		}
+
+		s := rc.State
+		a.laneOf(s.ThingID).projectStream <- &message{
+			State: &s,
+			record: &record{
+				seq:  rc.Seq,
+				refs: 1,
+			},
+			requestID: rc.RequestID,
+		}
+	}
+
+	a.Logger.WithFields(logrus.Fields{
+		"component": "link",
+	}).Info("WAL pipeline stage is going")
+	close(a.walCloseChan)
+}
+
 // projectStage finds project for each data based on its thing identification.
-func (a *Application) projectStage() {
+func (a *Application) projectStage(l *lane) {
 	// This thread is mine
 	runtime.LockOSThread()
 
@@ -33,38 +176,60 @@ func (a *Application) projectStage() {
 		"component": "link",
 	}).Info("Project pipeline stage")
 
-	for d := range a.projectStream {
+	for d := range l.projectStream {
+		start := time.Now()
+		statesIn.WithLabelValues("project").Inc()
+
 		// retrieve project when it is needed
 		if d.Project == "" {
-			t, err := pm.ThingByID(context.Background(), d.ThingID)
+			var t types.Thing
+			err := a.projectRetry.Do(a.exitChan, func() error {
+				var err error
+				t, err = pm.ThingByID(context.Background(), d.ThingID)
+				// unknown things are dead lettered without any retry
+				if _, ok := err.(pm.NotFoundError); ok {
+					return permanent(err)
+				}
+				return err
+			})
 			if err != nil {
-				a.Logger.WithFields(logrus.Fields{
-					"component": "link",
-					"asset":     d.Asset,
-					"thingid":   d.ThingID,
-				}).Errorf("Project find error: %s", err)
+				a.Logger.WithFields(d.fields()).Errorf("Project find error: %s", err)
+				stageErrors.WithLabelValues("project", "thing").Inc()
+				observe("project", start)
+				if err := a.deadLetter(*d.State, "project", err); err != nil {
+					a.Logger.WithFields(d.fields()).Errorf("Dead letter error: %s", err)
+				}
+				a.done(d)
 				continue
 			}
 			d.Project = t.Project
 		}
 
-		a.decodeStream <- d
+		// queued commands are delivered again when their thing appears
+		if a.undelivered.has(d.ThingID) {
+			go a.redeliver(d.ThingID)
+		}
+
+		observe("project", start)
+		statesOut.WithLabelValues("project").Inc()
+		if a.thingMetrics {
+			thingStates.inc(d.ThingID, a.metricsLimit)
+		}
+		if a.projectMetrics {
+			projectStates.inc(d.Project, a.metricsLimit)
+		}
+		l.decodeStream <- d
 	}
 
 	a.Logger.WithFields(logrus.Fields{
 		"component": "link",
 	}).Info("Project pipeline stage is going out")
-	select {
-	case a.projectCloseChan <- struct{}{}:
-		close(a.decodeStream)
-	default:
-	}
 }
 
 // decodeStage decodes each data and fills value section.
-// as you see there is no specific decode happens here so models
-// must do they job somewhere else
-func (a *Application) decodeStage() {
+// raw payloads are decoded by the model that their thing selects
+// and others are converted based on their type.
+func (a *Application) decodeStage(l *lane) {
 	// This thread is mine
 	runtime.LockOSThread()
 
@@ -72,83 +237,186 @@ func (a *Application) decodeStage() {
 		"component": "link",
 	}).Info("Decode pipeline stage")
 
-	for d := range a.decodeStream {
-		switch v := d.Raw.(type) { // find type of raw value
-		case string: // string
-			d.Value.String = v
-		case bool: // boolean
-			d.Value.Boolean = v
-		case float64: // number
-			d.Value.Number = v
-		case float32:
-			d.Value.Number = float64(v)
-		case int:
-			d.Value.Number = float64(v)
-		case int8:
-			d.Value.Number = float64(v)
-		case int16:
-			d.Value.Number = float64(v)
-		case int32:
-			d.Value.Number = float64(v)
-		case int64:
-			d.Value.Number = float64(v)
-		case uint:
-			d.Value.Number = float64(v)
-		case uint8:
-			d.Value.Number = float64(v)
-		case uint16:
-			d.Value.Number = float64(v)
-		case uint32:
-			d.Value.Number = float64(v)
-		case uint64:
-			d.Value.Number = float64(v)
-		case interface{}: // object
-			d.Value.Object = d.Raw
-		case []interface{}: // array
-			d.Value.Array = d.Raw.([]interface{})
+	for d := range l.decodeStream {
+		start := time.Now()
+		statesIn.WithLabelValues("decode").Inc()
+
+		ss, err := a.decode(d)
+		observe("decode", start)
+		if err != nil {
+			a.Logger.WithFields(d.fields()).Errorf("Decode error: %s", err)
+			stageErrors.WithLabelValues("decode", "model").Inc()
+			if err := a.deadLetter(*d.State, "decode", err); err != nil {
+				a.Logger.WithFields(d.fields()).Errorf("Dead letter error: %s", err)
+			}
+			a.done(d)
+			continue
+		}
+		if len(ss) == 0 {
+			a.done(d)
+			continue
+		}
+		// virtual assets are computed from the decoded states and they
+		// go through the pipeline like the others
+		ss = append(ss, a.derive(ss)...)
+		if d.record != nil {
+			atomic.AddInt32(&d.record.refs, int32(len(ss)-1))
 		}
 
-		go func(d types.State) {
-			// marshal data into json
-			b, err := json.Marshal(d)
-			if err != nil {
-				a.Logger.WithFields(logrus.Fields{
-					"component": "link",
-					"asset":     d.Asset,
-					"thingid":   d.ThingID,
-				}).Errorf("Marshal data error: %s", err)
+		for _, s := range ss {
+			m := &message{
+				State:     s,
+				record:    d.record,
+				requestID: d.requestID,
 			}
 
-			// publish data with both raw and typed formats
-			// i1820/projects/{project_id}/things/{thing_id}/assets/{asset_name}/state
-			a.cli.Publish(fmt.Sprintf("i1820/projects/%s/things/%s/assets/%s/state", d.Project, d.ThingID, d.Asset), 0, false, b)
-			a.Logger.WithFields(logrus.Fields{
-				"component": "link",
-				"asset":     d.Asset,
-				"thingid":   d.ThingID,
-			}).Infof("Publish decoded data: %s", d.Project)
-		}(*d)
+			// the latest state of each asset is kept in the last-value cache
+			// and it is published as a retained message
+			latest := a.states.update(*s)
+
+			// in ordered mode states are published and reported in the stage
+			// so they are published and reported in order
+			if a.ordered {
+				a.publish(*s, latest)
+				if a.shadows != nil {
+					a.report(*s)
+				}
+			} else {
+				go a.publish(*s, latest)
+				if a.shadows != nil {
+					go a.report(*s)
+				}
+			}
+
+			// rules are evaluated in order of the stage states
+			if a.rules != nil {
+				a.evaluate(*s)
+			}
+			a.Logger.WithFields(m.fields()).Infof("Decode with value: %+v", s.Value)
+
+			statesOut.WithLabelValues("decode").Inc()
+			l.insertStream <- m
+		}
+	}
+
+	a.Logger.WithFields(logrus.Fields{
+		"component": "link",
+	}).Info("Decode pipeline stage is going")
+}
+
+// publish publishes decoded state with both raw and typed formats on the following topic
+// i1820/projects/{project_id}/things/{thing_id}/assets/{asset_name}/state
+// the latest state of each asset is retained so new subscribers get it immediately.
+func (a *Application) publish(d types.State, retain bool) {
+	start := time.Now()
+	defer observe("publish", start)
+	statesIn.WithLabelValues("publish").Inc()
+
+	// marshal data into json
+	b, err := json.Marshal(d)
+	if err != nil {
+		stageErrors.WithLabelValues("publish", "marshal").Inc()
 		a.Logger.WithFields(logrus.Fields{
 			"component": "link",
 			"asset":     d.Asset,
 			"thingid":   d.ThingID,
-		}).Infof("Decode with value: %+v", d.Value)
-
-		a.insertStream <- d
+		}).Errorf("Marshal data error: %s", err)
+		return
 	}
 
+	a.cli.Publish(fmt.Sprintf("i1820/projects/%s/things/%s/assets/%s/state", d.Project, d.ThingID, d.Asset), 0, retain, b)
+	statesOut.WithLabelValues("publish").Inc()
 	a.Logger.WithFields(logrus.Fields{
 		"component": "link",
-	}).Info("Decode pipeline stage is going")
-	select {
-	case a.decodeCloseChan <- struct{}{}:
-		close(a.insertStream)
-	default:
+		"asset":     d.Asset,
+		"thingid":   d.ThingID,
+	}).Infof("Publish decoded data: %s", d.Project)
+}
+
+// decode runs thing model on the binary payload of given state. it returns
+// one state for each asset that model has decoded. payloads that cannot be decoded
+// return an error so they are not stored as decoded states.
+func (a *Application) decode(md *message) ([]*types.State, error) {
+	d := md.State
+
+	b, ok := d.Raw.([]byte)
+	if !ok {
+		fillValue(d, d.Raw)
+		return []*types.State{d}, nil
+	}
+
+	m, err := a.modelOf(context.Background(), d.ThingID)
+	if err != nil {
+		return nil, fmt.Errorf("Model find error: %s", err)
+	}
+	if m == nil {
+		fillValue(d, d.Raw)
+		return []*types.State{d}, nil
+	}
+
+	v := m.Decode(b)
+	if v == nil {
+		return nil, fmt.Errorf("Model %s cannot decode %q", m.Name(), b)
+	}
+
+	as, ok := v.(Assets)
+	if !ok {
+		fillValue(d, v)
+		return []*types.State{d}, nil
+	}
+
+	ss := make([]*types.State, 0, len(as))
+	for name, value := range as {
+		s := *d
+		s.Asset = name
+		fillValue(&s, value)
+		ss = append(ss, &s)
+	}
+	return ss, nil
+}
+
+// fillValue fills value section of given state based on type of given value
+func fillValue(d *types.State, value interface{}) {
+	switch v := value.(type) { // find type of value
+	case string: // string
+		d.Value.String = v
+	case bool: // boolean
+		d.Value.Boolean = v
+	case float64: // number
+		d.Value.Number = v
+	case float32:
+		d.Value.Number = float64(v)
+	case int:
+		d.Value.Number = float64(v)
+	case int8:
+		d.Value.Number = float64(v)
+	case int16:
+		d.Value.Number = float64(v)
+	case int32:
+		d.Value.Number = float64(v)
+	case int64:
+		d.Value.Number = float64(v)
+	case uint:
+		d.Value.Number = float64(v)
+	case uint8:
+		d.Value.Number = float64(v)
+	case uint16:
+		d.Value.Number = float64(v)
+	case uint32:
+		d.Value.Number = float64(v)
+	case uint64:
+		d.Value.Number = float64(v)
+	case []interface{}: // array
+		d.Value.Array = v
+	case interface{}: // object
+		d.Value.Object = v
 	}
 }
 
-// insertStage inserts each data to database
-func (a *Application) insertStage() {
+// insertStage inserts each data to application sinks.
+// states are accumulated and they are inserted together
+// when the batch is full or on each batch interval.
+func (a *Application) insertStage(l *lane) {
 	// This thread is mine
 	runtime.LockOSThread()
 
@@ -156,24 +424,106 @@ func (a *Application) insertStage() {
 		"component": "link",
 	}).Info("Insert pipeline stage")
 
-	for d := range a.insertStream {
-		if _, err := a.db.Collection(fmt.Sprintf("data.%s.%s", d.Project, d.ThingID)).InsertOne(context.Background(), *d); err != nil {
-			a.Logger.WithFields(logrus.Fields{
-				"component": "link",
-				"asset":     d.Asset,
-				"thingid":   d.ThingID,
-			}).Errorf("Mongo Insert: %s", err)
-		} else {
+	batch := make([]*message, 0, a.batchSize)
+
+	ticker := time.NewTicker(a.batchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case d, ok := <-l.insertStream:
+			if !ok {
+				if len(batch) > 0 {
+					a.insert(batch)
+				}
+
+				a.Logger.WithFields(logrus.Fields{
+					"component": "link",
+				}).Info("Insert pipeline stage is going")
+				a.insertCloseCounter.Done()
+				return
+			}
+
+			statesIn.WithLabelValues("insert").Inc()
+			batch = append(batch, d)
+			if len(batch) >= a.batchSize {
+				a.insert(batch)
+				batch = make([]*message, 0, a.batchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				a.insert(batch)
+				batch = make([]*message, 0, a.batchSize)
+			}
+		}
+	}
+}
+
+// insert inserts a batch of states into all sinks.
+// each sink insert is retried based on insert retry policy and then the states are stored as dead letters.
+// with write-ahead log, states are committed after all sinks or dead letters have them
+// and they are replayed on the next run when application exits during the retries.
+func (a *Application) insert(batch []*message) {
+	states := make([]types.State, len(batch))
+	for i, m := range batch {
+		states[i] = *m.State
+	}
+
+	start := time.Now()
+	defer observe("insert", start)
+
+	committable := true
+	for _, s := range a.sinks {
+		err := a.insertRetry.Do(a.exitChan, func() error {
+			start := time.Now()
+			defer func() {
+				sinkDuration.WithLabelValues(s.Name()).Observe(time.Since(start).Seconds())
+			}()
+
+			return s.Insert(context.Background(), states)
+		})
+		if err == nil {
 			a.Logger.WithFields(logrus.Fields{
 				"component": "link",
-				"asset":     d.Asset,
-				"thingid":   d.ThingID,
-			}).Infof("Insert into database with value: %+v", d.Value)
+				"sink":      s.Name(),
+			}).Infof("Insert %d states into sink", len(states))
+			continue
+		}
+
+		a.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"sink":      s.Name(),
+		}).Errorf("Sink Insert: %s", err)
+		stageErrors.WithLabelValues("insert", "sink").Inc()
+
+		if err == errRetryStopped && a.wal != nil {
+			committable = false
+			continue
+		}
+
+		reason := fmt.Errorf("sink %s: %s", s.Name(), err)
+		for _, m := range batch {
+			if err := a.deadLetter(*m.State, "insert", reason); err != nil {
+				a.Logger.WithFields(m.fields()).Errorf("Dead letter error: %s", err)
+				// parked states are committed so write-ahead log does not grow forever
+				if !a.park(*m.State, "insert", reason) {
+					committable = false
+				}
+			}
 		}
 	}
 
-	a.Logger.WithFields(logrus.Fields{
-		"component": "link",
-	}).Info("Insert pipeline stage is going")
-	a.insertCloseCounter.Done()
+	// buckets of inserted states are materialized again on the next rollup
+	if len(a.maintainers) > 0 && a.rollupInterval > 0 {
+		a.rollups.mark(states)
+	}
+
+	if !committable {
+		return
+	}
+
+	for _, m := range batch {
+		statesOut.WithLabelValues("insert").Inc()
+		a.done(m)
+	}
 }
@@ -0,0 +1,113 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     query.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/FANIoT/types"
+)
+
+// StatesPage is a page of stored states with the cursor of its next page.
+// the last page has no cursor.
+type StatesPage struct {
+	States []types.State `json:"states"`
+	Cursor string        `json:"cursor,omitempty"`
+}
+
+// cursor points to a state in the sorted states of an asset. it has the time of the state
+// and number of states with this time that are before it.
+type cursor struct {
+	at   time.Time
+	skip int
+}
+
+// String encodes cursor for clients
+func (c cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", c.at.UnixNano(), c.skip)))
+}
+
+// parseCursor decodes cursor of clients
+func parseCursor(s string) (cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, fmt.Errorf("Invalid cursor: %s", err)
+	}
+
+	var at int64
+	var skip int
+	if _, err := fmt.Sscanf(string(b), "%d.%d", &at, &skip); err != nil || skip < 0 {
+		return cursor{}, fmt.Errorf("Invalid cursor %s", s)
+	}
+
+	return cursor{
+		at:   time.Unix(0, at),
+		skip: skip,
+	}, nil
+}
+
+// History returns a page of thing asset states from the given time until before the to time
+// sorted by their time. the next page is requested with the cursor of the previous one.
+func (a *Application) History(ctx context.Context, project string, thingID string, asset string, from time.Time, to time.Time, limit int, c string) (StatesPage, error) {
+	q, err := a.querier()
+	if err != nil {
+		return StatesPage{}, err
+	}
+
+	skip := 0
+	if c != "" {
+		cr, err := parseCursor(c)
+		if err != nil {
+			return StatesPage{}, err
+		}
+		if cr.at.Before(from) {
+			return StatesPage{}, fmt.Errorf("Cursor %s is before the from time", c)
+		}
+		from = cr.at
+		skip = cr.skip
+	}
+
+	ss, err := q.Range(ctx, project, thingID, asset, from, to, skip, limit)
+	if err != nil {
+		return StatesPage{}, err
+	}
+
+	p := StatesPage{
+		States: ss,
+	}
+	if len(ss) == 0 || len(ss) < limit {
+		return p, nil
+	}
+
+	// next page starts after states of this page that have the time of its last state
+	last := ss[len(ss)-1].At
+	n := 0
+	for _, s := range ss {
+		if s.At.Equal(last) {
+			n++
+		}
+	}
+	if last.Equal(from) {
+		n += skip
+	}
+	p.Cursor = cursor{
+		at:   last,
+		skip: n,
+	}.String()
+
+	return p, nil
+}
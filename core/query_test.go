@@ -0,0 +1,62 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     query_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	s := NewMemorySink()
+	a := &Application{
+		sinks: []Sink{s},
+	}
+	now := time.Now()
+
+	// three states have the same time so they are split between pages
+	ss := make([]types.State, 0)
+	for i, d := range []time.Duration{0, time.Second, time.Second, time.Second, 2 * time.Second, 3 * time.Second} {
+		ss = append(ss, types.State{
+			ThingID: tID,
+			Project: "el-project",
+			Asset:   aName,
+			At:      now.Add(d),
+		})
+		ss[i].Value.Number = float64(i)
+	}
+	assert.NoError(t, s.Insert(context.Background(), ss))
+
+	values := make([]float64, 0)
+	c := ""
+	for {
+		p, err := a.History(context.Background(), "el-project", tID, aName, now, now.Add(3*time.Second), 2, c)
+		assert.NoError(t, err)
+		for _, s := range p.States {
+			values = append(values, s.Value.Number)
+		}
+		if p.Cursor == "" {
+			break
+		}
+		c = p.Cursor
+	}
+	assert.Equal(t, []float64{0, 1, 2, 3, 4}, values)
+
+	_, err := a.History(context.Background(), "el-project", tID, aName, now, time.Time{}, 2, "18.20")
+	assert.Error(t, err)
+}
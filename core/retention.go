@@ -0,0 +1,327 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     retention.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/envy"
+	"github.com/mongodb/mongo-go-driver/bson"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/replaceopt"
+	"github.com/sirupsen/logrus"
+)
+
+// RetentionPolicy specifies how long raw states and their hourly and daily rollups
+// of a project are kept. empty durations keep them forever.
+type RetentionPolicy struct {
+	Project string `json:"project" bson:"_id"`
+	Raw     string `json:"raw" bson:"raw"`
+	Hourly  string `json:"hourly" bson:"hourly"`
+	Daily   string `json:"daily" bson:"daily"`
+}
+
+// retentions returns retention duration of raw states and each rollup based on their collection prefix.
+// zero duration keeps states forever.
+func (p RetentionPolicy) retentions() (map[string]time.Duration, error) {
+	rs := make(map[string]time.Duration)
+	for prefix, d := range map[string]string{
+		rawPrefix:     p.Raw,
+		Rollups["1h"]: p.Hourly,
+		Rollups["1d"]: p.Daily,
+	} {
+		if d == "" {
+			rs[prefix] = 0
+			continue
+		}
+
+		r, err := time.ParseDuration(d)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s retention: %s", prefix, err)
+		}
+		if r < 0 {
+			return nil, fmt.Errorf("Invalid %s retention: %s is negative", prefix, d)
+		}
+		rs[prefix] = r
+	}
+	return rs, nil
+}
+
+// RetentionStore stores retention policies of projects
+type RetentionStore interface {
+	// Get returns retention policy of project or an error when project has not any
+	Get(ctx context.Context, project string) (RetentionPolicy, error)
+	Put(ctx context.Context, p RetentionPolicy) error
+	Delete(ctx context.Context, project string) error
+	List(ctx context.Context) ([]RetentionPolicy, error)
+
+	Name() string
+}
+
+// retentionsFromEnv creates retention policies store based on RETENTIONS environment variable
+// that is mongo or memory. it is mongo by default only when states are stored in mongodb.
+func retentionsFromEnv() (RetentionStore, error) {
+	switch name := envy.Get("RETENTIONS", defaultStore()); name {
+	case "mongo":
+		db, err := databaseFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return NewMongoRetentions(db), nil
+	case "memory":
+		return NewMemoryRetentions(), nil
+	default:
+		return nil, fmt.Errorf("Retentions store %s is not supported", name)
+	}
+}
+
+// MongoRetentions stores retention policies in retentions collection
+type MongoRetentions struct {
+	c *mgo.Collection
+}
+
+// NewMongoRetentions creates retention policies store on given database
+func NewMongoRetentions(db *mgo.Database) *MongoRetentions {
+	return &MongoRetentions{
+		c: db.Collection("retentions"),
+	}
+}
+
+// Name returns mongo retentions name
+func (*MongoRetentions) Name() string {
+	return "mongo"
+}
+
+// Get finds retention policy of project
+func (m *MongoRetentions) Get(ctx context.Context, project string) (RetentionPolicy, error) {
+	var p RetentionPolicy
+
+	dr := m.c.FindOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", project),
+	))
+	if err := dr.Decode(&p); err != nil {
+		if err == mgo.ErrNoDocuments {
+			return p, fmt.Errorf("Retention policy of %s not found", project)
+		}
+		return p, err
+	}
+
+	return p, nil
+}
+
+// Put inserts or replaces retention policy of project
+func (m *MongoRetentions) Put(ctx context.Context, p RetentionPolicy) error {
+	_, err := m.c.ReplaceOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", p.Project),
+	), p, replaceopt.Upsert(true))
+	return err
+}
+
+// Delete removes retention policy of project
+func (m *MongoRetentions) Delete(ctx context.Context, project string) error {
+	r, err := m.c.DeleteOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", project),
+	))
+	if err != nil {
+		return err
+	}
+	if r.DeletedCount == 0 {
+		return fmt.Errorf("Retention policy of %s not found", project)
+	}
+	return nil
+}
+
+// List returns all of the retention policies
+func (m *MongoRetentions) List(ctx context.Context) ([]RetentionPolicy, error) {
+	ps := make([]RetentionPolicy, 0)
+
+	cur, err := m.c.Find(ctx, bson.NewDocument())
+	if err != nil {
+		return ps, err
+	}
+
+	for cur.Next(ctx) {
+		var p RetentionPolicy
+
+		if err := cur.Decode(&p); err != nil {
+			return ps, err
+		}
+
+		ps = append(ps, p)
+	}
+	if err := cur.Close(ctx); err != nil {
+		return ps, err
+	}
+
+	return ps, nil
+}
+
+// MemoryRetentions stores retention policies in memory
+type MemoryRetentions struct {
+	policies map[string]RetentionPolicy
+	lock     sync.RWMutex
+}
+
+// NewMemoryRetentions creates an empty memory retention policies store
+func NewMemoryRetentions() *MemoryRetentions {
+	return &MemoryRetentions{
+		policies: make(map[string]RetentionPolicy),
+	}
+}
+
+// Name returns memory retentions name
+func (*MemoryRetentions) Name() string {
+	return "memory"
+}
+
+// Get finds retention policy of project
+func (m *MemoryRetentions) Get(_ context.Context, project string) (RetentionPolicy, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	p, ok := m.policies[project]
+	if !ok {
+		return p, fmt.Errorf("Retention policy of %s not found", project)
+	}
+	return p, nil
+}
+
+// Put inserts or replaces retention policy of project
+func (m *MemoryRetentions) Put(_ context.Context, p RetentionPolicy) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.policies[p.Project] = p
+	return nil
+}
+
+// Delete removes retention policy of project
+func (m *MemoryRetentions) Delete(_ context.Context, project string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.policies[project]; !ok {
+		return fmt.Errorf("Retention policy of %s not found", project)
+	}
+	delete(m.policies, project)
+	return nil
+}
+
+// List returns all of the retention policies sorted by their project
+func (m *MemoryRetentions) List(_ context.Context) ([]RetentionPolicy, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	ps := make([]RetentionPolicy, 0, len(m.policies))
+	for _, p := range m.policies {
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i].Project < ps[j].Project
+	})
+	return ps, nil
+}
+
+// Retention returns retention policy of project or the default policy
+// when project has not any
+func (a *Application) Retention(ctx context.Context, project string) RetentionPolicy {
+	p, err := a.retentions.Get(ctx, project)
+	if err != nil {
+		p = a.retention
+		p.Project = project
+	}
+	return p
+}
+
+// SetRetention validates and stores retention policy of project
+func (a *Application) SetRetention(ctx context.Context, project string, p RetentionPolicy) (RetentionPolicy, error) {
+	p.Project = project
+	if _, err := p.retentions(); err != nil {
+		return p, err
+	}
+
+	return p, a.retentions.Put(ctx, p)
+}
+
+// DeleteRetention removes retention policy of project so it uses the default policy
+func (a *Application) DeleteRetention(ctx context.Context, project string) error {
+	return a.retentions.Delete(ctx, project)
+}
+
+// retain removes states of sinks that are older than retention policy of their project
+func (a *Application) retain() {
+	ps, err := a.retentions.List(context.Background())
+	if err != nil {
+		a.Logger.WithFields(logrus.Fields{
+			"component": "link",
+		}).Errorf("Retention policies list error: %s", err)
+		return
+	}
+
+	policies := make(map[string]map[string]time.Duration)
+	for _, p := range ps {
+		rs, err := p.retentions()
+		if err != nil {
+			a.Logger.WithFields(logrus.Fields{
+				"component": "link",
+				"project":   p.Project,
+			}).Errorf("Retention policy error: %s", err)
+			continue
+		}
+		policies[p.Project] = rs
+	}
+	def, err := a.retention.retentions()
+	if err != nil {
+		def = make(map[string]time.Duration)
+	}
+
+	for _, m := range a.maintainers {
+		n, err := m.Retain(context.Background(), func(project string) map[string]time.Duration {
+			if rs, ok := policies[project]; ok {
+				return rs
+			}
+			return def
+		}, time.Now())
+		if err != nil {
+			a.Logger.WithFields(logrus.Fields{
+				"component": "link",
+			}).Errorf("Retention error: %s", err)
+			continue
+		}
+		if n > 0 {
+			a.Logger.WithFields(logrus.Fields{
+				"component": "link",
+			}).Infof("%d states are removed by retention policies", n)
+		}
+	}
+}
+
+// retentionStage enforces retention policies periodically
+func (a *Application) retentionStage() {
+	ticker := time.NewTicker(a.retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.retain()
+		case <-a.exitChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     retry.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/envy"
+)
+
+// errRetryStopped is returned when retrying is stopped before the function succeeds
+var errRetryStopped = errors.New("retry is stopped")
+
+// permanentError is an error that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+// permanent marks given error as permanent so it is returned without any retry
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+// RetryPolicy retries a failed function with exponential backoff.
+// MaxAttempts less than or equal to zero means retrying forever.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+// retryPolicyFromEnv creates retry policy of given stage from following environment variables
+// RETRY_{STAGE}_ATTEMPTS, RETRY_{STAGE}_BACKOFF and RETRY_MAX_BACKOFF
+func retryPolicyFromEnv(stage string, attempts string, backoff string) (RetryPolicy, error) {
+	var p RetryPolicy
+	stage = strings.ToUpper(stage)
+
+	n, err := strconv.Atoi(envy.Get(fmt.Sprintf("RETRY_%s_ATTEMPTS", stage), attempts))
+	if err != nil {
+		return p, err
+	}
+	p.MaxAttempts = n
+
+	b, err := time.ParseDuration(envy.Get(fmt.Sprintf("RETRY_%s_BACKOFF", stage), backoff))
+	if err != nil {
+		return p, err
+	}
+	p.InitialBackoff = b
+
+	m, err := time.ParseDuration(envy.Get("RETRY_MAX_BACKOFF", "30s"))
+	if err != nil {
+		return p, err
+	}
+	p.MaxBackoff = m
+
+	p.Multiplier = 2
+
+	return p, nil
+}
+
+// Backoff returns waiting time before the given attempt (attempts start from one)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	b := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		b *= p.Multiplier
+		if time.Duration(b) >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return time.Duration(b)
+}
+
+// Do calls f until it succeeds or it runs out of attempts or it returns a permanent error.
+// it returns the last error of f or errRetryStopped when stop channel is closed during a backoff.
+func (p RetryPolicy) Do(stop <-chan struct{}, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		if p, ok := err.(permanentError); ok {
+			return p.err
+		}
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return err
+		}
+
+		select {
+		case <-time.After(p.Backoff(attempt)):
+		case <-stop:
+			return errRetryStopped
+		}
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     retry_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	p := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     3 * time.Millisecond,
+		Multiplier:     2,
+	}
+
+	assert.Equal(t, time.Millisecond, p.Backoff(1))
+	assert.Equal(t, 2*time.Millisecond, p.Backoff(2))
+	assert.Equal(t, 3*time.Millisecond, p.Backoff(3))
+
+	n := 0
+	assert.Error(t, p.Do(nil, func() error {
+		n++
+		return fmt.Errorf("18.20")
+	}))
+	assert.Equal(t, 3, n)
+
+	n = 0
+	assert.NoError(t, p.Do(nil, func() error {
+		n++
+		if n < 2 {
+			return fmt.Errorf("18.20")
+		}
+		return nil
+	}))
+	assert.Equal(t, 2, n)
+
+	n = 0
+	assert.Error(t, p.Do(nil, func() error {
+		n++
+		return permanent(fmt.Errorf("18.20"))
+	}))
+	assert.Equal(t, 1, n)
+
+	stop := make(chan struct{})
+	close(stop)
+	p.MaxAttempts = 0
+	assert.Equal(t, errRetryStopped, p.Do(stop, func() error {
+		return fmt.Errorf("18.20")
+	}))
+}
@@ -0,0 +1,136 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     rollup.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/sirupsen/logrus"
+)
+
+// rawPrefix is the collection prefix of raw states
+const rawPrefix = "data"
+
+// Rollups maps rollup buckets to their collection prefix. each thing has
+// its rollup collections with following name {prefix}.{project_id}.{thing_id}
+var Rollups = map[string]string{
+	"1h": "hourly",
+	"1d": "daily",
+}
+
+// rollupKey is an asset bucket that its rollup must be materialized again
+type rollupKey struct {
+	project string
+	thingID string
+	asset   string
+	bucket  string
+	at      time.Time
+}
+
+// rollupSet has asset buckets that have new states since their last rollup
+type rollupSet struct {
+	keys map[rollupKey]struct{}
+	lock sync.Mutex
+}
+
+// newRollupSet creates an empty rollup set
+func newRollupSet() *rollupSet {
+	return &rollupSet{
+		keys: make(map[rollupKey]struct{}),
+	}
+}
+
+// mark adds buckets of given states into the set
+func (r *rollupSet) mark(ss []types.State) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, s := range ss {
+		for bucket := range Rollups {
+			r.keys[rollupKey{
+				project: s.Project,
+				thingID: s.ThingID,
+				asset:   s.Asset,
+				bucket:  bucket,
+				at:      s.At.Truncate(Buckets[bucket]),
+			}] = struct{}{}
+		}
+	}
+}
+
+// add adds given bucket into the set
+func (r *rollupSet) add(k rollupKey) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.keys[k] = struct{}{}
+}
+
+// drain returns and removes all of the set buckets
+func (r *rollupSet) drain() []rollupKey {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	keys := make([]rollupKey, 0, len(r.keys))
+	for k := range r.keys {
+		keys = append(keys, k)
+	}
+	r.keys = make(map[rollupKey]struct{})
+	return keys
+}
+
+// rollup materializes rollups of the marked buckets in all of the maintainer sinks.
+// failed buckets are marked again so they are materialized on the next rollup.
+func (a *Application) rollup() {
+	keys := a.rollups.drain()
+
+	for _, m := range a.maintainers {
+		for _, k := range keys {
+			if err := m.Rollup(context.Background(), k.project, k.thingID, k.asset, k.at, k.bucket); err != nil {
+				a.Logger.WithFields(logrus.Fields{
+					"component": "link",
+					"asset":     k.asset,
+					"thingid":   k.thingID,
+					"bucket":    k.bucket,
+				}).Errorf("Rollup error: %s", err)
+
+				a.rollups.add(k)
+			}
+		}
+	}
+
+	if len(keys) > 0 {
+		a.Logger.WithFields(logrus.Fields{
+			"component": "link",
+		}).Infof("Rollup %d buckets", len(keys))
+	}
+}
+
+// rollupStage materializes rollups periodically
+func (a *Application) rollupStage() {
+	ticker := time.NewTicker(a.rollupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.rollup()
+		case <-a.exitChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     rollup_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollupSet(t *testing.T) {
+	r := newRollupSet()
+	now := time.Date(2018, 10, 18, 10, 20, 0, 0, time.UTC)
+
+	r.mark([]types.State{
+		{ThingID: tID, Project: "el-project", Asset: aName, At: now},
+		{ThingID: tID, Project: "el-project", Asset: aName, At: now.Add(time.Minute)},
+		{ThingID: tID, Project: "el-project", Asset: aName, At: now.Add(time.Hour)},
+	})
+
+	keys := r.drain()
+	assert.Len(t, keys, 3)
+	for _, k := range keys {
+		if k.bucket == "1d" {
+			assert.Equal(t, now.Truncate(24*time.Hour), k.at)
+		}
+	}
+	assert.Len(t, r.drain(), 0)
+}
+
+func TestRetention(t *testing.T) {
+	a := &Application{
+		retentions: NewMemoryRetentions(),
+		retention: RetentionPolicy{
+			Raw: "720h",
+		},
+	}
+	ctx := context.Background()
+
+	p := a.Retention(ctx, "el-project")
+	assert.Equal(t, "el-project", p.Project)
+	assert.Equal(t, "720h", p.Raw)
+
+	_, err := a.SetRetention(ctx, "el-project", RetentionPolicy{Raw: "18.20"})
+	assert.Error(t, err)
+	_, err = a.SetRetention(ctx, "el-project", RetentionPolicy{Raw: "-1h"})
+	assert.Error(t, err)
+
+	_, err = a.SetRetention(ctx, "el-project", RetentionPolicy{Raw: "24h", Hourly: "8760h"})
+	assert.NoError(t, err)
+	rs, err := a.Retention(ctx, "el-project").retentions()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"data": 24 * time.Hour, "hourly": 8760 * time.Hour, "daily": 0}, rs)
+
+	assert.NoError(t, a.DeleteRetention(ctx, "el-project"))
+	assert.Error(t, a.DeleteRetention(ctx, "el-project"))
+	assert.Equal(t, "720h", a.Retention(ctx, "el-project").Raw)
+}
@@ -0,0 +1,521 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     rule.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/gobuffalo/envy"
+	"github.com/mongodb/mongo-go-driver/bson"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/replaceopt"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrRulesDisabled is returned when there is no rule store
+var ErrRulesDisabled = errors.New("Rules are disabled")
+
+// Rule is a threshold rule on the decoded values of a project asset.
+// its expression is like `temperature > 40 for 5m` or `battery < 10%` and it fires when
+// the condition holds for the given duration. firing rule is resolved when the value crosses
+// the threshold back by its hysteresis.
+type Rule struct {
+	ID         string  `json:"id" bson:"_id"`
+	Project    string  `json:"project" bson:"project"`
+	Name       string  `json:"name" bson:"name"`
+	Expression string  `json:"expression" bson:"expression"`
+	Hysteresis float64 `json:"hysteresis" bson:"hysteresis"`
+	ThingID    string  `json:"thingid" bson:"thingid"` // rule applies to all of the project things when it is empty
+	Webhook    string  `json:"webhook" bson:"webhook"` // optional http or https url that alerts are posted to
+}
+
+// expressionRegexp matches rule expressions. percentages are compared with
+// their number so percent assets must report numbers between 0 and 100.
+var expressionRegexp = regexp.MustCompile(`^\s*([\w.-]+)\s*(>=|<=|==|!=|>|<)\s*(-?[0-9]+(?:\.[0-9]+)?)\s*%?\s*(?:for\s+(\S+))?\s*$`)
+
+// condition is a parsed rule expression
+type condition struct {
+	asset     string
+	operator  string
+	threshold float64
+	duration  time.Duration
+}
+
+// parseExpression parses rule expression
+func parseExpression(e string) (condition, error) {
+	m := expressionRegexp.FindStringSubmatch(e)
+	if m == nil {
+		return condition{}, fmt.Errorf("Invalid rule expression %q", e)
+	}
+
+	threshold, err := strconv.ParseFloat(m[3], 64)
+	if err != nil {
+		return condition{}, fmt.Errorf("Invalid rule threshold %q: %s", m[3], err)
+	}
+
+	var d time.Duration
+	if m[4] != "" {
+		d, err = time.ParseDuration(m[4])
+		if err != nil || d < 0 {
+			return condition{}, fmt.Errorf("Invalid rule duration %q", m[4])
+		}
+	}
+
+	return condition{
+		asset:     m[1],
+		operator:  m[2],
+		threshold: threshold,
+		duration:  d,
+	}, nil
+}
+
+// holds reports whether condition holds for given value
+func (c condition) holds(v float64) bool {
+	switch c.operator {
+	case ">":
+		return v > c.threshold
+	case ">=":
+		return v >= c.threshold
+	case "<":
+		return v < c.threshold
+	case "<=":
+		return v <= c.threshold
+	case "==":
+		return v == c.threshold
+	case "!=":
+		return v != c.threshold
+	}
+	return false
+}
+
+// clears reports whether value clears firing condition. values must cross
+// the threshold back by the hysteresis.
+func (c condition) clears(v float64, hysteresis float64) bool {
+	switch c.operator {
+	case ">", ">=":
+		return v < c.threshold-hysteresis
+	case "<", "<=":
+		return v > c.threshold+hysteresis
+	}
+	return !c.holds(v)
+}
+
+// RuleStore stores rules of projects
+type RuleStore interface {
+	Put(ctx context.Context, r Rule) error
+	Get(ctx context.Context, id string) (Rule, error)
+	Delete(ctx context.Context, id string) error
+	// List returns rules of project or all of the rules when project is empty
+	List(ctx context.Context, project string) ([]Rule, error)
+
+	Name() string
+}
+
+// rulesFromEnv creates rule and alert stores based on RULES environment variable
+// that is mongo, memory or none. there are no stores with none.
+func rulesFromEnv() (RuleStore, AlertStore, error) {
+	switch name := envy.Get("RULES", "none"); name {
+	case "mongo":
+		db, err := databaseFromEnv()
+		if err != nil {
+			return nil, nil, err
+		}
+		return NewMongoRules(db), NewMongoAlerts(db), nil
+	case "memory":
+		return NewMemoryRules(), NewMemoryAlerts(), nil
+	case "none":
+		return nil, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("Rules store %s is not supported", name)
+	}
+}
+
+// MongoRules stores rules in rules collection
+type MongoRules struct {
+	c *mgo.Collection
+}
+
+// NewMongoRules creates rules store on given database
+func NewMongoRules(db *mgo.Database) *MongoRules {
+	return &MongoRules{
+		c: db.Collection("rules"),
+	}
+}
+
+// Name returns mongo rules name
+func (*MongoRules) Name() string {
+	return "mongo"
+}
+
+// Put inserts or replaces given rule
+func (m *MongoRules) Put(ctx context.Context, r Rule) error {
+	_, err := m.c.ReplaceOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", r.ID),
+	), r, replaceopt.Upsert(true))
+	return err
+}
+
+// Get finds rule by its id
+func (m *MongoRules) Get(ctx context.Context, id string) (Rule, error) {
+	var r Rule
+
+	dr := m.c.FindOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", id),
+	))
+	if err := dr.Decode(&r); err != nil {
+		if err == mgo.ErrNoDocuments {
+			return r, fmt.Errorf("Rule %s not found", id)
+		}
+		return r, err
+	}
+
+	return r, nil
+}
+
+// Delete removes rule by its id
+func (m *MongoRules) Delete(ctx context.Context, id string) error {
+	r, err := m.c.DeleteOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", id),
+	))
+	if err != nil {
+		return err
+	}
+	if r.DeletedCount == 0 {
+		return fmt.Errorf("Rule %s not found", id)
+	}
+	return nil
+}
+
+// List returns rules of project
+func (m *MongoRules) List(ctx context.Context, project string) ([]Rule, error) {
+	rs := make([]Rule, 0)
+
+	filter := bson.NewDocument()
+	if project != "" {
+		filter.Append(bson.EC.String("project", project))
+	}
+
+	cur, err := m.c.Find(ctx, filter)
+	if err != nil {
+		return rs, err
+	}
+
+	for cur.Next(ctx) {
+		var r Rule
+
+		if err := cur.Decode(&r); err != nil {
+			return rs, err
+		}
+
+		rs = append(rs, r)
+	}
+	if err := cur.Close(ctx); err != nil {
+		return rs, err
+	}
+
+	return rs, nil
+}
+
+// MemoryRules stores rules in memory
+type MemoryRules struct {
+	rules map[string]Rule
+	lock  sync.RWMutex
+}
+
+// NewMemoryRules creates an empty memory rule store
+func NewMemoryRules() *MemoryRules {
+	return &MemoryRules{
+		rules: make(map[string]Rule),
+	}
+}
+
+// Name returns memory rules name
+func (*MemoryRules) Name() string {
+	return "memory"
+}
+
+// Put inserts or replaces given rule
+func (m *MemoryRules) Put(_ context.Context, r Rule) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.rules[r.ID] = r
+	return nil
+}
+
+// Get finds rule by its id
+func (m *MemoryRules) Get(_ context.Context, id string) (Rule, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	r, ok := m.rules[id]
+	if !ok {
+		return r, fmt.Errorf("Rule %s not found", id)
+	}
+	return r, nil
+}
+
+// Delete removes rule by its id
+func (m *MemoryRules) Delete(_ context.Context, id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.rules[id]; !ok {
+		return fmt.Errorf("Rule %s not found", id)
+	}
+	delete(m.rules, id)
+	return nil
+}
+
+// List returns rules of project sorted by their id
+func (m *MemoryRules) List(_ context.Context, project string) ([]Rule, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	rs := make([]Rule, 0)
+	for _, r := range m.rules {
+		if project == "" || r.Project == project {
+			rs = append(rs, r)
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].ID < rs[j].ID
+	})
+	return rs, nil
+}
+
+// compiledRule is a rule with its parsed expression
+type compiledRule struct {
+	Rule
+	condition
+}
+
+// ruleState is the state of a rule for a thing. condition holds from its pending time
+// and rule is firing when it holds for the rule duration.
+type ruleState struct {
+	pending time.Time
+	firing  bool
+}
+
+// ruleEngine evaluates rules of projects on the decoded states
+type ruleEngine struct {
+	rules  map[string][]compiledRule        // rules of each project
+	states map[string]map[string]*ruleState // states of each rule for things
+	lock   sync.Mutex
+}
+
+// newRuleEngine creates a rule engine without any rule
+func newRuleEngine() *ruleEngine {
+	return &ruleEngine{
+		rules:  make(map[string][]compiledRule),
+		states: make(map[string]map[string]*ruleState),
+	}
+}
+
+// load replaces engine rules with given rules. states of the rules that are
+// not changed are kept and invalid rules are returned with their errors.
+func (e *ruleEngine) load(rs []Rule) map[string]error {
+	errs := make(map[string]error)
+
+	rules := make(map[string][]compiledRule)
+	ids := make(map[string]Rule)
+	for _, r := range rs {
+		c, err := parseExpression(r.Expression)
+		if err != nil {
+			errs[r.ID] = err
+			continue
+		}
+		rules[r.Project] = append(rules[r.Project], compiledRule{
+			Rule:      r,
+			condition: c,
+		})
+		ids[r.ID] = r
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	// states of the changed and removed rules are reset
+	for _, prs := range e.rules {
+		for _, r := range prs {
+			if n, ok := ids[r.ID]; !ok || n != r.Rule {
+				delete(e.states, r.ID)
+			}
+		}
+	}
+	e.rules = rules
+
+	return errs
+}
+
+// evaluate evaluates rules of state project on the state and returns their alerts
+func (e *ruleEngine) evaluate(s types.State) []ruleAlert {
+	if !numeric(s) {
+		return nil
+	}
+	v := s.Value.Number
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	alerts := make([]ruleAlert, 0)
+	for _, r := range e.rules[s.Project] {
+		if r.asset != s.Asset || (r.ThingID != "" && r.ThingID != s.ThingID) {
+			continue
+		}
+
+		if _, ok := e.states[r.ID]; !ok {
+			e.states[r.ID] = make(map[string]*ruleState)
+		}
+		st, ok := e.states[r.ID][s.ThingID]
+		if !ok {
+			st = &ruleState{}
+			e.states[r.ID][s.ThingID] = st
+		}
+
+		if st.firing {
+			if r.clears(v, r.Hysteresis) {
+				st.firing = false
+				st.pending = time.Time{}
+				alerts = append(alerts, ruleAlert{newAlert(r.Rule, s, AlertResolved), r.Webhook})
+			}
+			continue
+		}
+
+		if !r.holds(v) {
+			st.pending = time.Time{}
+			continue
+		}
+		if st.pending.IsZero() {
+			st.pending = s.At
+		}
+		if s.At.Sub(st.pending) >= r.duration {
+			st.firing = true
+			alerts = append(alerts, ruleAlert{newAlert(r.Rule, s, AlertFiring), r.Webhook})
+		}
+	}
+	return alerts
+}
+
+// reloadRules loads rules of all projects from the rule store into the rule engine
+func (a *Application) reloadRules(ctx context.Context) error {
+	rs, err := a.rules.List(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	for id, err := range a.engine.load(rs) {
+		a.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"rule":      id,
+		}).Errorf("Rule load error: %s", err)
+	}
+	return nil
+}
+
+// ruleStage reloads rules periodically so rules that are changed by other instances are applied
+func (a *Application) ruleStage() {
+	ticker := time.NewTicker(a.rulesReload)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.reloadRules(context.Background()); err != nil {
+				a.Logger.WithFields(logrus.Fields{
+					"component": "link",
+				}).Errorf("Rules reload error: %s", err)
+			}
+		case <-a.exitChan:
+			return
+		}
+	}
+}
+
+// PutRule validates and stores rule of project then reloads rules. rules without
+// identification are created with a new one.
+func (a *Application) PutRule(ctx context.Context, project string, r Rule) (Rule, error) {
+	if a.rules == nil {
+		return r, ErrRulesDisabled
+	}
+
+	if _, err := parseExpression(r.Expression); err != nil {
+		return r, err
+	}
+	if r.Hysteresis < 0 {
+		return r, fmt.Errorf("Rule hysteresis %g is negative", r.Hysteresis)
+	}
+	if r.Webhook != "" {
+		if err := a.validateWebhook(r.Webhook); err != nil {
+			return r, err
+		}
+	}
+
+	if r.ID == "" {
+		r.ID = newID()
+	} else if old, err := a.rules.Get(ctx, r.ID); err == nil && old.Project != project {
+		return r, fmt.Errorf("Rule %s not found", r.ID)
+	}
+	r.Project = project
+
+	if err := a.rules.Put(ctx, r); err != nil {
+		return r, err
+	}
+	return r, a.reloadRules(ctx)
+}
+
+// Rules returns rules of project
+func (a *Application) Rules(ctx context.Context, project string) ([]Rule, error) {
+	if a.rules == nil {
+		return nil, ErrRulesDisabled
+	}
+
+	return a.rules.List(ctx, project)
+}
+
+// RuleByID finds rule of project by its id
+func (a *Application) RuleByID(ctx context.Context, project string, id string) (Rule, error) {
+	if a.rules == nil {
+		return Rule{}, ErrRulesDisabled
+	}
+
+	r, err := a.rules.Get(ctx, id)
+	if err != nil {
+		return r, err
+	}
+	if r.Project != project {
+		return Rule{}, fmt.Errorf("Rule %s not found", id)
+	}
+	return r, nil
+}
+
+// DeleteRule removes rule of project then reloads rules
+func (a *Application) DeleteRule(ctx context.Context, project string, id string) error {
+	if _, err := a.RuleByID(ctx, project, id); err != nil {
+		return err
+	}
+
+	if err := a.rules.Delete(ctx, id); err != nil {
+		return err
+	}
+	return a.reloadRules(ctx)
+}
@@ -0,0 +1,123 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     rule_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExpression(t *testing.T) {
+	c, err := parseExpression("temperature > 40 for 5m")
+	assert.NoError(t, err)
+	assert.Equal(t, condition{asset: "temperature", operator: ">", threshold: 40, duration: 5 * time.Minute}, c)
+
+	c, err = parseExpression("battery < 10%")
+	assert.NoError(t, err)
+	assert.Equal(t, condition{asset: "battery", operator: "<", threshold: 10}, c)
+
+	_, err = parseExpression("temperature ~ 40")
+	assert.Error(t, err)
+	_, err = parseExpression("temperature > 40 for ever")
+	assert.Error(t, err)
+}
+
+func TestRuleEngine(t *testing.T) {
+	e := newRuleEngine()
+	assert.Len(t, e.load([]Rule{
+		{ID: "1", Project: "el-project", Expression: "temperature > 40 for 5m", Hysteresis: 2},
+		{ID: "2", Project: "el-project", Expression: "18.20"},
+	}), 1)
+
+	now := time.Now()
+	state := func(v float64, d time.Duration) types.State {
+		s := types.State{ThingID: tID, Project: "el-project", Asset: "temperature", At: now.Add(d), Raw: v}
+		s.Value.Number = v
+		return s
+	}
+
+	// debounce
+	assert.Len(t, e.evaluate(state(41, 0)), 0)
+	assert.Len(t, e.evaluate(state(39, time.Minute)), 0)
+	assert.Len(t, e.evaluate(state(41, 2*time.Minute)), 0)
+	as := e.evaluate(state(42, 7*time.Minute))
+	assert.Len(t, as, 1)
+	assert.Equal(t, AlertFiring, as[0].Status)
+
+	// hysteresis
+	assert.Len(t, e.evaluate(state(39, 8*time.Minute)), 0)
+	as = e.evaluate(state(37, 9*time.Minute))
+	assert.Len(t, as, 1)
+	assert.Equal(t, AlertResolved, as[0].Status)
+
+	// changed rules lose their states
+	assert.Len(t, e.evaluate(state(41, 10*time.Minute)), 0)
+	e.load([]Rule{
+		{ID: "1", Project: "el-project", Expression: "temperature > 40"},
+	})
+	assert.Len(t, e.evaluate(state(41, 10*time.Minute)), 1)
+}
+
+func TestAlertOrder(t *testing.T) {
+	a := &Application{
+		engine:      newRuleEngine(),
+		alertQueues: []chan ruleAlert{make(chan ruleAlert, 8), make(chan ruleAlert, 8), make(chan ruleAlert, 8)},
+	}
+	a.engine.load([]Rule{
+		{ID: "1", Project: "el-project", Expression: "temperature > 40"},
+	})
+
+	now := time.Now()
+	for i, v := range []float64{41, 39, 41, 39} {
+		s := types.State{ThingID: tID, Project: "el-project", Asset: "temperature", At: now.Add(time.Duration(i) * time.Second), Raw: v}
+		s.Value.Number = v
+		a.evaluate(s)
+	}
+
+	// alerts of the rule are in the same queue in order of evaluation
+	statuses := make([]AlertStatus, 0)
+	for _, q := range a.alertQueues {
+		for len(q) > 0 {
+			statuses = append(statuses, (<-q).Status)
+		}
+	}
+	assert.Equal(t, []AlertStatus{AlertFiring, AlertResolved, AlertFiring, AlertResolved}, statuses)
+}
+
+func TestValidateWebhook(t *testing.T) {
+	a := &Application{}
+	assert.NoError(t, a.validateWebhook("https://hooks.example.com/alerts"))
+	assert.NoError(t, a.validateWebhook("http://93.184.216.34:8080/alerts"))
+	assert.Error(t, a.validateWebhook("file:///etc/passwd"))
+	assert.Error(t, a.validateWebhook("gopher://hooks.example.com"))
+	assert.Error(t, a.validateWebhook("http://localhost:1372/things"))
+	assert.Error(t, a.validateWebhook("http://127.0.0.1/"))
+	assert.Error(t, a.validateWebhook("http://169.254.169.254/latest/meta-data"))
+	assert.Error(t, a.validateWebhook("http://10.0.0.1/"))
+	assert.Error(t, a.validateWebhook("http://[::1]/"))
+
+	// webhook hosts are the only allowed hosts
+	a.webhookHosts = map[string]bool{"alerts.internal": true}
+	assert.NoError(t, a.validateWebhook("http://alerts.internal/hook"))
+	assert.Error(t, a.validateWebhook("https://hooks.example.com/alerts"))
+
+	// webhooks client does not connect to private addresses
+	a.webhookHosts = nil
+	_, err := a.newWebhookClient(time.Second).Get("http://127.0.0.1:1/")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), errPrivateWebhook.Error())
+}
@@ -0,0 +1,458 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     shadow.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FANIoT/link/pm"
+	"github.com/FANIoT/types"
+	"github.com/gobuffalo/envy"
+	"github.com/mongodb/mongo-go-driver/bson"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/updateopt"
+	cache "github.com/patrickmn/go-cache"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrShadowsDisabled is returned when there is no shadow store
+var ErrShadowsDisabled = errors.New("Device shadows are disabled")
+
+// Shadow is the device shadow of a thing. it has the last reported state of each asset
+// and the desired state that applications set for them. delta has desired values
+// that are not reported yet and it is pushed to the thing as a command.
+type Shadow struct {
+	ThingID   string                 `json:"thingid" bson:"_id"`
+	Reported  map[string]types.State `json:"reported" bson:"reported"`
+	Desired   map[string]types.State `json:"desired" bson:"desired"`
+	Delta     map[string]interface{} `json:"delta" bson:"-"`
+	UpdatedAt time.Time              `json:"updated_at" bson:"updated_at"`
+}
+
+// delta compares desired values with the reported ones and fills shadow delta.
+// values are normalized before comparison so numbers of different types are equal.
+func (s *Shadow) delta() {
+	s.Delta = make(map[string]interface{})
+	for asset, d := range s.Desired {
+		r, ok := s.Reported[asset]
+		if !ok || !sameValue(r, d) {
+			s.Delta[asset] = d.Raw
+		}
+	}
+}
+
+// normalize converts numbers into float64 and documents into maps recursively, so values that are
+// decoded from different sources are comparable. for example mongodb decodes 1 as int32 but json as float64.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case []interface{}:
+		n := make([]interface{}, len(v))
+		for i, e := range v {
+			n[i] = normalize(e)
+		}
+		return n
+	case map[string]interface{}:
+		n := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			n[k] = normalize(e)
+		}
+		return n
+	case *bson.Document:
+		n := make(map[string]interface{}, v.Len())
+		for it := v.Iterator(); it.Next(); {
+			e := it.Element()
+			n[e.Key()] = normalize(bsonInterface(e.Value()))
+		}
+		return n
+	}
+	return v
+}
+
+// bsonInterface returns go value of given bson value with documents and arrays that can be normalized
+func bsonInterface(v *bson.Value) interface{} {
+	switch v.Type() {
+	case bson.TypeEmbeddedDocument:
+		return v.MutableDocument()
+	case bson.TypeArray:
+		a := v.MutableArray()
+		n := make([]interface{}, 0, a.Len())
+		for i := 0; i < a.Len(); i++ {
+			if e, err := a.Lookup(uint(i)); err == nil {
+				n = append(n, bsonInterface(e))
+			}
+		}
+		return n
+	}
+	return v.Interface()
+}
+
+// sameValue reports whether given states have the same value
+func sameValue(r types.State, d types.State) bool {
+	return r.Value.Number == d.Value.Number &&
+		r.Value.String == d.Value.String &&
+		r.Value.Boolean == d.Value.Boolean &&
+		reflect.DeepEqual(normalize(r.Value.Array), normalize(d.Value.Array)) &&
+		reflect.DeepEqual(normalize(r.Value.Object), normalize(d.Value.Object))
+}
+
+// ShadowStore stores device shadows. desired states have the requested value
+// in their raw section.
+type ShadowStore interface {
+	// Get returns shadow of thing or an empty shadow when thing has not any
+	Get(ctx context.Context, thingID string) (Shadow, error)
+	// Report sets the reported state of state asset
+	Report(ctx context.Context, s types.State) error
+	// Desire sets given desired states and removes desired states of given assets
+	Desire(ctx context.Context, thingID string, desired []types.State, removed []string) error
+
+	Name() string
+}
+
+// shadowsFromEnv creates shadow store based on SHADOWS environment variable
+// that is mongo, memory or none. there is no store with none.
+func shadowsFromEnv() (ShadowStore, error) {
+	switch name := envy.Get("SHADOWS", "none"); name {
+	case "mongo":
+		db, err := databaseFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return NewMongoShadows(db), nil
+	case "memory":
+		return NewMemoryShadows(), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("Shadows store %s is not supported", name)
+	}
+}
+
+// shadowKeys escapes asset names in update paths because mongodb reads dots as nested fields
+// and it does not accept field names that start with dollar sign
+var (
+	shadowKeys   = strings.NewReplacer("%", "%25", ".", "%2E", "$", "%24")
+	shadowAssets = strings.NewReplacer("%25", "%", "%2E", ".", "%24", "$")
+)
+
+// shadowStates returns given shadow states by their asset names instead of their escaped keys
+func shadowStates(ss map[string]types.State) map[string]types.State {
+	n := make(map[string]types.State, len(ss))
+	for k, s := range ss {
+		if s.Asset == "" {
+			s.Asset = shadowAssets.Replace(k)
+		}
+		n[s.Asset] = s
+	}
+	return n
+}
+
+// MongoShadows stores shadows in shadows collection. asset names are escaped in its documents.
+type MongoShadows struct {
+	c *mgo.Collection
+}
+
+// NewMongoShadows creates shadows store on given database
+func NewMongoShadows(db *mgo.Database) *MongoShadows {
+	return &MongoShadows{
+		c: db.Collection("shadows"),
+	}
+}
+
+// Name returns mongo shadows name
+func (*MongoShadows) Name() string {
+	return "mongo"
+}
+
+// Get finds shadow of thing
+func (m *MongoShadows) Get(ctx context.Context, thingID string) (Shadow, error) {
+	s := Shadow{
+		ThingID:  thingID,
+		Reported: make(map[string]types.State),
+		Desired:  make(map[string]types.State),
+	}
+
+	dr := m.c.FindOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", thingID),
+	))
+	if err := dr.Decode(&s); err != nil && err != mgo.ErrNoDocuments {
+		return s, err
+	}
+	s.Reported = shadowStates(s.Reported)
+	s.Desired = shadowStates(s.Desired)
+
+	return s, nil
+}
+
+// Report sets the reported state of state asset
+func (m *MongoShadows) Report(ctx context.Context, s types.State) error {
+	_, err := m.c.UpdateOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", s.ThingID),
+	), bson.NewDocument(
+		bson.EC.SubDocumentFromElements("$set",
+			bson.EC.Interface(fmt.Sprintf("reported.%s", shadowKeys.Replace(s.Asset)), s),
+			bson.EC.DateTime("updated_at", time.Now().UnixNano()/int64(time.Millisecond)),
+		),
+	), updateopt.Upsert(true))
+	return err
+}
+
+// Desire sets given desired states and removes desired states of given assets
+func (m *MongoShadows) Desire(ctx context.Context, thingID string, desired []types.State, removed []string) error {
+	set := bson.NewDocument(
+		bson.EC.DateTime("updated_at", time.Now().UnixNano()/int64(time.Millisecond)),
+	)
+	for _, s := range desired {
+		set.Append(bson.EC.Interface(fmt.Sprintf("desired.%s", shadowKeys.Replace(s.Asset)), s))
+	}
+	update := bson.NewDocument(
+		bson.EC.SubDocument("$set", set),
+	)
+	if len(removed) > 0 {
+		unset := bson.NewDocument()
+		for _, asset := range removed {
+			unset.Append(bson.EC.String(fmt.Sprintf("desired.%s", shadowKeys.Replace(asset)), ""))
+		}
+		update.Append(bson.EC.SubDocument("$unset", unset))
+	}
+
+	_, err := m.c.UpdateOne(ctx, bson.NewDocument(
+		bson.EC.String("_id", thingID),
+	), update, updateopt.Upsert(true))
+	return err
+}
+
+// MemoryShadows stores shadows in memory
+type MemoryShadows struct {
+	shadows map[string]Shadow
+	lock    sync.RWMutex
+}
+
+// NewMemoryShadows creates an empty memory shadow store
+func NewMemoryShadows() *MemoryShadows {
+	return &MemoryShadows{
+		shadows: make(map[string]Shadow),
+	}
+}
+
+// Name returns memory shadows name
+func (*MemoryShadows) Name() string {
+	return "memory"
+}
+
+// shadow returns a copy of thing shadow, its maps are copied too.
+// caller must hold the lock.
+func (m *MemoryShadows) shadow(thingID string) Shadow {
+	s := Shadow{
+		ThingID:  thingID,
+		Reported: make(map[string]types.State),
+		Desired:  make(map[string]types.State),
+	}
+
+	old, ok := m.shadows[thingID]
+	if !ok {
+		return s
+	}
+	for asset, r := range old.Reported {
+		s.Reported[asset] = r
+	}
+	for asset, d := range old.Desired {
+		s.Desired[asset] = d
+	}
+	s.UpdatedAt = old.UpdatedAt
+	return s
+}
+
+// Get returns shadow of thing
+func (m *MemoryShadows) Get(_ context.Context, thingID string) (Shadow, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.shadow(thingID), nil
+}
+
+// Report sets the reported state of state asset
+func (m *MemoryShadows) Report(_ context.Context, s types.State) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	sh := m.shadow(s.ThingID)
+	sh.Reported[s.Asset] = s
+	sh.UpdatedAt = time.Now()
+	m.shadows[s.ThingID] = sh
+	return nil
+}
+
+// Desire sets given desired states and removes desired states of given assets
+func (m *MemoryShadows) Desire(_ context.Context, thingID string, desired []types.State, removed []string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	sh := m.shadow(thingID)
+	for _, s := range desired {
+		sh.Desired[s.Asset] = s
+	}
+	for _, asset := range removed {
+		delete(sh.Desired, asset)
+	}
+	sh.UpdatedAt = time.Now()
+	m.shadows[thingID] = sh
+	return nil
+}
+
+// Shadow returns shadow of thing with its delta
+func (a *Application) Shadow(ctx context.Context, thingID string) (Shadow, error) {
+	if a.shadows == nil {
+		return Shadow{}, ErrShadowsDisabled
+	}
+
+	s, err := a.shadows.Get(ctx, thingID)
+	if err != nil {
+		return s, err
+	}
+	s.delta()
+	return s, nil
+}
+
+// Desire updates desired state of thing assets. assets with nil values are removed
+// from desired state. new delta is pushed to the thing immediately.
+func (a *Application) Desire(ctx context.Context, thingID string, values map[string]interface{}) (Shadow, error) {
+	if a.shadows == nil {
+		return Shadow{}, ErrShadowsDisabled
+	}
+
+	t, err := pm.ThingByID(ctx, thingID)
+	if err != nil {
+		return Shadow{}, err
+	}
+
+	now := time.Now()
+	desired := make([]types.State, 0, len(values))
+	removed := make([]string, 0)
+	for asset, v := range values {
+		if v == nil {
+			removed = append(removed, asset)
+			continue
+		}
+
+		s := types.State{
+			Raw:     v,
+			At:      now,
+			ThingID: thingID,
+			Asset:   asset,
+			Project: t.Project,
+		}
+		fillValue(&s, v)
+		desired = append(desired, s)
+	}
+
+	if err := a.shadows.Desire(ctx, thingID, desired, removed); err != nil {
+		return Shadow{}, err
+	}
+
+	return a.syncShadow(ctx, thingID, true)
+}
+
+// SyncShadow pushes delta of thing shadow to it. connectivities call it
+// when things are connected again.
+func (a *Application) SyncShadow(ctx context.Context, thingID string) error {
+	if a.shadows == nil {
+		return nil
+	}
+
+	_, err := a.syncShadow(ctx, thingID, true)
+	return err
+}
+
+// syncShadow pushes shadow delta as a command when it is not empty. without force
+// delta is pushed at most once in each shadow push interval.
+func (a *Application) syncShadow(ctx context.Context, thingID string, force bool) (Shadow, error) {
+	if !force {
+		if _, ok := a.shadowPushes.Get(thingID); ok {
+			return Shadow{}, nil
+		}
+	}
+
+	s, err := a.Shadow(ctx, thingID)
+	if err != nil {
+		return s, err
+	}
+	if len(s.Delta) == 0 {
+		return s, nil
+	}
+
+	a.shadowPushes.Set(thingID, true, cache.DefaultExpiration)
+	c, err := a.Command(ctx, thingID, CommandRequest{
+		Value: s.Delta,
+	})
+	if err != nil {
+		return s, err
+	}
+
+	a.Logger.WithFields(logrus.Fields{
+		"component": "link",
+		"thingid":   thingID,
+		"command":   c.ID,
+	}).Infof("Shadow delta is %s: %v", c.Status, s.Delta)
+	return s, nil
+}
+
+// report stores decoded state as the reported state of its asset and
+// pushes the remaining delta to its thing
+func (a *Application) report(d types.State) {
+	if err := a.shadows.Report(context.Background(), d); err != nil {
+		a.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"asset":     d.Asset,
+			"thingid":   d.ThingID,
+		}).Errorf("Shadow report error: %s", err)
+		return
+	}
+
+	if _, err := a.syncShadow(context.Background(), d.ThingID, false); err != nil {
+		a.Logger.WithFields(logrus.Fields{
+			"component": "link",
+			"thingid":   d.ThingID,
+		}).Errorf("Shadow sync error: %s", err)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     shadow_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/FANIoT/types"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShadowDelta(t *testing.T) {
+	a := &Application{
+		shadows: NewMemoryShadows(),
+	}
+	ctx := context.Background()
+
+	valve := types.State{ThingID: tID, Asset: "valve", Raw: true}
+	fillValue(&valve, true)
+	relay := types.State{ThingID: tID, Asset: "relay", Raw: 1}
+	fillValue(&relay, 1)
+	assert.NoError(t, a.shadows.Desire(ctx, tID, []types.State{valve, relay}, nil))
+
+	s, err := a.Shadow(ctx, tID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"valve": true, "relay": 1}, s.Delta)
+
+	// numbers are compared based on their decoded value
+	reported := types.State{ThingID: tID, Asset: "relay"}
+	fillValue(&reported, 1.0)
+	assert.NoError(t, a.shadows.Report(ctx, reported))
+	reported = types.State{ThingID: tID, Asset: "valve"}
+	fillValue(&reported, false)
+	assert.NoError(t, a.shadows.Report(ctx, reported))
+
+	s, err = a.Shadow(ctx, tID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"valve": true}, s.Delta)
+	assert.Len(t, s.Reported, 2)
+
+	assert.NoError(t, a.shadows.Desire(ctx, tID, nil, []string{"valve"}))
+	s, err = a.Shadow(ctx, tID)
+	assert.NoError(t, err)
+	assert.Len(t, s.Delta, 0)
+
+	a.shadows = nil
+	_, err = a.Shadow(ctx, tID)
+	assert.Equal(t, ErrShadowsDisabled, err)
+}
+
+func TestShadowNormalize(t *testing.T) {
+	desired := types.State{Asset: "leds"}
+	fillValue(&desired, []interface{}{int32(1), int64(2), map[string]interface{}{"on": int32(1)}})
+	reported := types.State{Asset: "leds"}
+	fillValue(&reported, []interface{}{1.0, 2.0, bson.NewDocument(bson.EC.Double("on", 1))})
+
+	assert.True(t, sameValue(reported, desired))
+	reported.Value.Array[1] = 3.0
+	assert.False(t, sameValue(reported, desired))
+}
+
+func TestShadowKeys(t *testing.T) {
+	for _, asset := range []string{"temperature", "room.temperature", "$where", "50%.duty", "%2E"} {
+		key := shadowKeys.Replace(asset)
+		assert.NotContains(t, key, ".")
+		assert.NotContains(t, key, "$")
+		assert.Equal(t, asset, shadowAssets.Replace(key))
+	}
+
+	ss := shadowStates(map[string]types.State{
+		"room%2Etemperature": {Asset: "room.temperature"},
+		"%24where":           {},
+	})
+	assert.Contains(t, ss, "room.temperature")
+	assert.Contains(t, ss, "$where")
+}
@@ -0,0 +1,89 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     sink.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/gobuffalo/envy"
+)
+
+// Sink is a storage backend for decoded states.
+// insert stage writes each batch of states into all of the application sinks.
+type Sink interface {
+	Insert(ctx context.Context, states []types.State) error
+
+	Name() string
+}
+
+// Querier is a sink that reads stored states back
+type Querier interface {
+	// Latest returns the latest state of each asset of thing or the latest state
+	// of given asset when it is not empty
+	Latest(ctx context.Context, project string, thingID string, asset string) ([]types.State, error)
+	// Range returns at most limit states of thing asset from the given time until before the to time,
+	// sorted by their time, after skipping the first skip states. zero to time has no bound.
+	Range(ctx context.Context, project string, thingID string, asset string, from time.Time, to time.Time, skip int, limit int) ([]types.State, error)
+}
+
+// Aggregator is a sink that aggregates stored states itself
+type Aggregator interface {
+	// Aggregate returns buckets of thing asset numeric states from the given time until
+	// before the to time, sorted by their time. zero to time has no bound.
+	Aggregate(ctx context.Context, project string, thingID string, asset string, from time.Time, to time.Time, bucket time.Duration) ([]Bucket, error)
+}
+
+// Maintainer is a sink that maintains stored states in the background
+type Maintainer interface {
+	// Rollup materializes aggregate of thing asset states in the bucket that starts at given time
+	// into the rollup collection of bucket
+	Rollup(ctx context.Context, project string, thingID string, asset string, at time.Time, bucket string) error
+	// Retain removes raw states and rollups that are older than retention of their project
+	// and returns number of removed ones. retention of each project maps collection prefixes
+	// to their retention duration and zero duration keeps them forever.
+	Retain(ctx context.Context, retentionOf func(project string) map[string]time.Duration, now time.Time) (int64, error)
+}
+
+// sinksFromEnv creates sinks that are listed in SINKS environment variable.
+// SINKS is a comma separated list of mongo, memory and file.
+func sinksFromEnv() ([]Sink, error) {
+	sinks := make([]Sink, 0)
+
+	for _, name := range strings.Split(envy.Get("SINKS", "mongo"), ",") {
+		switch strings.TrimSpace(name) {
+		case "mongo":
+			db, err := databaseFromEnv()
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, NewMongoSink(db))
+		case "memory":
+			sinks = append(sinks, NewMemorySink())
+		case "file":
+			s, err := NewFileSink(envy.Get("SINK_FILE_PATH", "link.jsonl"))
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, s)
+		default:
+			return nil, fmt.Errorf("Sink %s is not supported", name)
+		}
+	}
+
+	return sinks, nil
+}
@@ -0,0 +1,214 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     state.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FANIoT/link/pm"
+	"github.com/FANIoT/types"
+)
+
+// ErrNoQuerier is returned when none of the application sinks can read states back
+var ErrNoQuerier = errors.New("There is no sink that supports queries")
+
+// assetStates has the latest state of each asset of a thing.
+// it is loaded when it has the latest states of all stored assets.
+type assetStates struct {
+	thingID string
+	states  map[string]types.State
+	loaded  bool
+	expires time.Time
+}
+
+// stateCache is the last-value cache of things states. it keeps at most size things and evicts
+// the least recently used one after that, things are also evicted after ttl so they are read
+// from sinks again. evicted things are loaded again from sinks on their next read.
+type stateCache struct {
+	things map[string]*list.Element
+	order  *list.List // things from the most recently used to the least recently used
+	size   int
+	ttl    time.Duration
+	lock   sync.Mutex
+}
+
+// newStateCache creates an empty last-value cache with given size and ttl
+func newStateCache(size int, ttl time.Duration) *stateCache {
+	return &stateCache{
+		things: make(map[string]*list.Element),
+		order:  list.New(),
+		size:   size,
+		ttl:    ttl,
+	}
+}
+
+// thing returns cached states of thing and marks them as recently used.
+// it returns nil when thing is not cached or its states are expired.
+func (c *stateCache) thing(thingID string) *assetStates {
+	e, ok := c.things[thingID]
+	if !ok {
+		return nil
+	}
+
+	t := e.Value.(*assetStates)
+	if time.Now().After(t.expires) {
+		c.order.Remove(e)
+		delete(c.things, thingID)
+		return nil
+	}
+
+	c.order.MoveToFront(e)
+	return t
+}
+
+// thingOrNew returns cached states of thing or caches empty states for it
+// and evicts the least recently used thing when cache is full.
+func (c *stateCache) thingOrNew(thingID string) *assetStates {
+	if t := c.thing(thingID); t != nil {
+		return t
+	}
+
+	t := &assetStates{
+		thingID: thingID,
+		states:  make(map[string]types.State),
+		expires: time.Now().Add(c.ttl),
+	}
+	c.things[thingID] = c.order.PushFront(t)
+
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.things, e.Value.(*assetStates).thingID)
+	}
+
+	return t
+}
+
+// update stores given state when it is newer than the cached one of its asset
+// and reports whether it is stored.
+func (c *stateCache) update(s types.State) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t := c.thingOrNew(s.ThingID)
+
+	if l, ok := t.states[s.Asset]; ok && s.At.Before(l.At) {
+		return false
+	}
+	t.states[s.Asset] = s
+	return true
+}
+
+// load marks cached states of thing as loaded
+func (c *stateCache) load(thingID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.thingOrNew(thingID).loaded = true
+}
+
+// get returns cached states of thing sorted by their assets or only the state of given asset
+// when it is not empty. it reports whether cached states are loaded.
+func (c *stateCache) get(thingID string, asset string) ([]types.State, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ss := make([]types.State, 0)
+
+	t := c.thing(thingID)
+	if t == nil {
+		return ss, false
+	}
+
+	if asset != "" {
+		if s, ok := t.states[asset]; ok {
+			ss = append(ss, s)
+		}
+		return ss, t.loaded
+	}
+
+	for _, s := range t.states {
+		ss = append(ss, s)
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		return ss[i].Asset < ss[j].Asset
+	})
+	return ss, t.loaded
+}
+
+// querier returns the first application sink that supports queries
+func (a *Application) querier() (Querier, error) {
+	for _, s := range a.sinks {
+		if q, ok := s.(Querier); ok {
+			return q, nil
+		}
+	}
+	return nil, ErrNoQuerier
+}
+
+// States returns the latest state of each asset of thing. they are read from
+// the last-value cache and cold cache is filled from the first sink that supports queries.
+func (a *Application) States(ctx context.Context, thingID string) ([]types.State, error) {
+	return a.latest(ctx, thingID, "")
+}
+
+// AssetState returns the latest state of thing asset
+func (a *Application) AssetState(ctx context.Context, thingID string, asset string) (types.State, error) {
+	ss, err := a.latest(ctx, thingID, asset)
+	if err != nil {
+		return types.State{}, err
+	}
+	if len(ss) == 0 {
+		return types.State{}, fmt.Errorf("Asset %s of thing %s has no state", asset, thingID)
+	}
+	return ss[0], nil
+}
+
+// latest reads the latest states of thing or the latest state of asset when it is not empty
+func (a *Application) latest(ctx context.Context, thingID string, asset string) ([]types.State, error) {
+	ss, loaded := a.states.get(thingID, asset)
+	if loaded || (asset != "" && len(ss) > 0) {
+		return ss, nil
+	}
+
+	q, err := a.querier()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := pm.ThingByID(ctx, thingID)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := q.Latest(ctx, t.Project, thingID, asset)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range stored {
+		a.states.update(s)
+	}
+	if asset == "" {
+		a.states.load(thingID)
+	}
+
+	ss, _ = a.states.get(thingID, asset)
+	return ss, nil
+}
@@ -0,0 +1,89 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     state_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateCache(t *testing.T) {
+	c := newStateCache(2, time.Hour)
+	now := time.Now()
+
+	assert.True(t, c.update(types.State{ThingID: tID, Asset: aName, At: now}))
+	assert.True(t, c.update(types.State{ThingID: tID, Asset: "cpu", At: now}))
+	assert.False(t, c.update(types.State{ThingID: tID, Asset: aName, At: now.Add(-time.Second)}))
+	assert.True(t, c.update(types.State{ThingID: tID, Asset: aName, At: now.Add(time.Second)}))
+
+	ss, loaded := c.get(tID, "")
+	assert.False(t, loaded)
+	assert.Len(t, ss, 2)
+	assert.Equal(t, "cpu", ss[0].Asset)
+	assert.Equal(t, now.Add(time.Second), ss[1].At)
+
+	c.load(tID)
+	ss, loaded = c.get(tID, "cpu")
+	assert.True(t, loaded)
+	assert.Len(t, ss, 1)
+
+	ss, loaded = c.get("18.20", "")
+	assert.False(t, loaded)
+	assert.Len(t, ss, 0)
+
+	// the least recently used thing is evicted when cache is full
+	assert.True(t, c.update(types.State{ThingID: "18.20", Asset: aName, At: now}))
+	ss, _ = c.get(tID, "")
+	assert.Len(t, ss, 2)
+	assert.True(t, c.update(types.State{ThingID: "20.18", Asset: aName, At: now}))
+	ss, _ = c.get("18.20", "")
+	assert.Len(t, ss, 0)
+	ss, loaded = c.get(tID, "")
+	assert.True(t, loaded)
+	assert.Len(t, ss, 2)
+
+	// things are evicted after ttl so they are loaded again
+	c = newStateCache(2, time.Millisecond)
+	c.update(types.State{ThingID: tID, Asset: aName, At: now})
+	c.load(tID)
+	time.Sleep(2 * time.Millisecond)
+	ss, loaded = c.get(tID, "")
+	assert.False(t, loaded)
+	assert.Len(t, ss, 0)
+}
+
+func TestMemorySinkLatest(t *testing.T) {
+	s := NewMemorySink()
+	now := time.Now()
+
+	assert.NoError(t, s.Insert(context.Background(), []types.State{
+		{ThingID: tID, Project: "el-project", Asset: aName, At: now},
+		{ThingID: tID, Project: "el-project", Asset: aName, At: now.Add(-time.Second)},
+		{ThingID: tID, Project: "el-project", Asset: "cpu", At: now},
+		{ThingID: "18.20", Project: "el-project", Asset: aName, At: now.Add(time.Second)},
+	}))
+
+	ss, err := s.Latest(context.Background(), "el-project", tID, aName)
+	assert.NoError(t, err)
+	assert.Len(t, ss, 1)
+	assert.Equal(t, now, ss[0].At)
+
+	ss, err = s.Latest(context.Background(), "el-project", tID, "")
+	assert.NoError(t, err)
+	assert.Len(t, ss, 2)
+}
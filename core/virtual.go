@@ -0,0 +1,149 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     virtual.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"context"
+	"sort"
+
+	"github.com/FANIoT/link/pm"
+	"github.com/FANIoT/types"
+	"github.com/sirupsen/logrus"
+)
+
+// expressionOf returns compiled expression. each expression is compiled only once.
+func (a *Application) expressionOf(e string) (*expression, error) {
+	a.virtualsLock.Lock()
+	defer a.virtualsLock.Unlock()
+
+	if x, ok := a.virtuals[e]; ok {
+		return x, nil
+	}
+
+	x, err := compileExpression(e)
+	if err != nil {
+		return nil, err
+	}
+	a.virtuals[e] = x
+	return x, nil
+}
+
+// derive computes virtual assets of decoded states thing. virtual assets are defined beside
+// their thing in pm like `power = voltage * current` and each of them is computed when any of its
+// input assets arrives. inputs are the latest values of thing assets that are overlaid with the decoded states.
+func (a *Application) derive(ss []*types.State) []*types.State {
+	thingID := ss[0].ThingID
+
+	logger := a.Logger.WithFields(logrus.Fields{
+		"component": "link",
+		"thingid":   thingID,
+	})
+
+	defs, err := pm.VirtualsByThingID(context.Background(), thingID)
+	if err != nil {
+		logger.Warnf("Virtual assets find error: %s", err)
+		return nil
+	}
+	if len(defs) == 0 {
+		return nil
+	}
+
+	virtuals := make(map[string]*expression)
+	for name, e := range defs {
+		x, err := a.expressionOf(e)
+		if err != nil {
+			logger.Errorf("Virtual asset %s is not valid: %s", name, err)
+			continue
+		}
+		virtuals[name] = x
+	}
+
+	latest, _ := a.states.get(thingID, "")
+	vs, errs := derive(virtuals, latest, ss)
+	for name, err := range errs {
+		logger.Warnf("Virtual asset %s error: %s", name, err)
+	}
+	return vs
+}
+
+// derive evaluates the virtual assets that have any input in the given states. virtual assets are not
+// inputs of each other so derived states never trigger other virtual assets.
+func derive(virtuals map[string]*expression, latest []types.State, ss []*types.State) ([]*types.State, map[string]error) {
+	inputs := make(map[string]float64)
+	for _, s := range latest {
+		if numeric(s) {
+			inputs[s.Asset] = s.Value.Number
+		}
+	}
+
+	arrived := make(map[string]bool)
+	last := ss[0]
+	for _, s := range ss {
+		arrived[s.Asset] = true
+		if numeric(*s) {
+			inputs[s.Asset] = s.Value.Number
+		}
+		if s.At.After(last.At) {
+			last = s
+		}
+	}
+
+	names := make([]string, 0, len(virtuals))
+	for name := range virtuals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vs := make([]*types.State, 0)
+	errs := make(map[string]error)
+	for _, name := range names {
+		x := virtuals[name]
+
+		// decoded states take precedence over virtual assets with the same name
+		if arrived[name] {
+			continue
+		}
+		triggered := false
+		for _, asset := range x.assets() {
+			if arrived[asset] {
+				triggered = true
+				break
+			}
+		}
+		if !triggered {
+			continue
+		}
+
+		v, err := x.eval(inputs)
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+
+		d := &types.State{
+			ThingID: last.ThingID,
+			Project: last.Project,
+			Asset:   name,
+			At:      last.At,
+			Raw:     v,
+		}
+		fillValue(d, v)
+		vs = append(vs, d)
+	}
+	if len(errs) == 0 {
+		errs = nil
+	}
+
+	return vs, errs
+}
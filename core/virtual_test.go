@@ -0,0 +1,96 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     virtual_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileExpression(t *testing.T) {
+	tests := []struct {
+		expression string
+		result     float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"-2 ^ 2", -4},
+		{"2 ^ 3 ^ 2", 512},
+		{"7 % 4 - 1", 2},
+		{"max(1, voltage, 3) + abs(-current)", 14},
+		{"round(voltage * current)", 24},
+	}
+	vars := map[string]float64{"voltage": 12, "current": 2}
+
+	for _, test := range tests {
+		e, err := compileExpression(test.expression)
+		assert.NoError(t, err, test.expression)
+
+		v, err := e.eval(vars)
+		assert.NoError(t, err, test.expression)
+		assert.InDelta(t, test.result, v, 1e-9, test.expression)
+	}
+
+	e, err := compileExpression("temperature - (100 - humidity) / 5")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"humidity", "temperature"}, e.assets())
+	_, err = e.eval(map[string]float64{"temperature": 20})
+	assert.Error(t, err)
+
+	e, err = compileExpression("1 / voltage")
+	assert.NoError(t, err)
+	_, err = e.eval(map[string]float64{"voltage": 0})
+	assert.Error(t, err)
+
+	for _, expression := range []string{"", "1 +", "(1", "1 2", "os.exit(1)", "pow(1)", "voltage; current", "a = 1"} {
+		_, err := compileExpression(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestDerive(t *testing.T) {
+	power, err := compileExpression("voltage * current")
+	assert.NoError(t, err)
+	virtuals := map[string]*expression{"power": power}
+
+	at := time.Now()
+	latest := []types.State{
+		{ThingID: tID, Asset: "current", At: at.Add(-time.Minute), Raw: 2.0},
+	}
+	latest[0].Value.Number = 2
+
+	voltage := &types.State{ThingID: tID, Project: aName, Asset: "voltage", At: at, Raw: 12.0}
+	voltage.Value.Number = 12
+	vs, errs := derive(virtuals, latest, []*types.State{voltage})
+	assert.Nil(t, errs)
+	if assert.Len(t, vs, 1) {
+		assert.Equal(t, "power", vs[0].Asset)
+		assert.Equal(t, aName, vs[0].Project)
+		assert.Equal(t, at, vs[0].At)
+		assert.Equal(t, 24.0, vs[0].Value.Number)
+	}
+
+	// states that are not inputs of virtual assets do not trigger them
+	humidity := &types.State{ThingID: tID, Project: aName, Asset: "humidity", At: at}
+	vs, _ = derive(virtuals, latest, []*types.State{humidity})
+	assert.Len(t, vs, 0)
+
+	// virtual assets without all of their inputs are not computed
+	vs, errs = derive(virtuals, nil, []*types.State{voltage})
+	assert.Len(t, vs, 0)
+	assert.Contains(t, errs, "power")
+}
@@ -0,0 +1,473 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     wal.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/ugorji/go/codec"
+)
+
+// errWALStopped is returned by WAL.Next when log reading is stopped
+var errWALStopped = errors.New("write-ahead log is stopped")
+
+// errWALCorrupted is returned by WAL.read when a record does not match its checksum or it cannot be decoded.
+// its frame is read completely so the records after it can be read.
+var errWALCorrupted = errors.New("corrupted record")
+
+// maxWALRecordSize bounds the length of a record frame, larger lengths are from corrupted frames
+const maxWALRecordSize = 64 * 1024 * 1024
+
+// walRecord is stored for each state in write-ahead log
+type walRecord struct {
+	Seq       uint64
+	State     types.State
+	RequestID string
+}
+
+// WAL is a write-ahead log for incoming states.
+// states are appended into segment files in the log directory and pipeline reads them in order.
+// each record has a sequence number and pipeline commits sequences after their states are inserted,
+// log keeps the first uncommitted sequence in its checkpoint file, so on open it replays
+// all of the uncommitted records. segments that are fully committed are removed.
+//
+// each record is framed as: length (4 bytes) | crc32 (4 bytes) | cbor encoded record
+type WAL struct {
+	dir         string
+	sync        bool
+	segmentSize int64
+
+	lock sync.Mutex
+	cond *sync.Cond
+
+	// writer
+	segments []uint64 // start sequence of each segment in order
+	w        *os.File
+	wSize    int64
+	next     uint64 // sequence of the next appended record
+
+	// reader
+	r       *bufio.Reader
+	rFile   *os.File
+	rSeg    int    // index of reader segment in segments
+	rSeq    uint64 // sequence of the next read record
+	stopped bool
+
+	// checkpoint
+	committed      uint64 // all sequences before it are committed
+	pending        map[uint64]bool
+	checkpointed   uint64
+	checkpointTime time.Time
+
+	h codec.CborHandle
+}
+
+// OpenWAL opens (or creates) write-ahead log in given directory. segments are rotated
+// when they reach the segment size and appends are flushed to disk when fsync is true.
+func OpenWAL(dir string, segmentSize int64, fsync bool) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	w := &WAL{
+		dir:         dir,
+		sync:        fsync,
+		segmentSize: segmentSize,
+
+		pending: make(map[uint64]bool),
+	}
+	w.cond = sync.NewCond(&w.lock)
+
+	// read the checkpoint
+	b, err := ioutil.ReadFile(filepath.Join(dir, "checkpoint"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		c, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checkpoint: %s", err)
+		}
+		w.committed = c
+	}
+	w.checkpointed = w.committed
+
+	// find segments
+	names, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		s, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), ".wal"), 10, 64)
+		if err != nil {
+			continue
+		}
+		w.segments = append(w.segments, s)
+	}
+	sort.Slice(w.segments, func(i, j int) bool {
+		return w.segments[i] < w.segments[j]
+	})
+
+	// open the last segment for appending after removing its torn tail
+	if len(w.segments) == 0 {
+		if err := w.rotate(w.committed); err != nil {
+			return nil, err
+		}
+	} else if err := w.recover(); err != nil {
+		return nil, err
+	}
+
+	// reader starts from the segment that contains the checkpoint
+	w.rSeg = 0
+	for i, s := range w.segments {
+		if s <= w.committed {
+			w.rSeg = i
+		}
+	}
+	w.rSeq = w.segments[w.rSeg]
+	if err := w.openReader(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// recover scans the last segment to find the next sequence and truncates
+// the partially written record that is left from a crash.
+func (w *WAL) recover() error {
+	start := w.segments[len(w.segments)-1]
+
+	f, err := os.OpenFile(w.segment(start), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	w.next = start
+	var offset int64
+	r := bufio.NewReader(f)
+	for {
+		rc, n, err := w.read(r)
+		if err == errWALCorrupted {
+			// corrupted records are skipped by the reader so they are kept
+			offset += n
+			w.next++
+			continue
+		}
+		if err != nil {
+			break
+		}
+		offset += n
+		w.next = rc.Seq + 1
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+
+	w.w = f
+	w.wSize = offset
+	if w.next < w.committed {
+		w.next = w.committed
+	}
+
+	return nil
+}
+
+// segment returns file name of the segment that starts from given sequence
+func (w *WAL) segment(start uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d.wal", start))
+}
+
+// rotate closes current segment and creates new one that starts from given sequence
+func (w *WAL) rotate(start uint64) error {
+	if w.w != nil {
+		if err := w.w.Close(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(w.segment(start), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.w = f
+	w.wSize = 0
+	w.next = start
+	w.segments = append(w.segments, start)
+
+	return nil
+}
+
+// Append writes given state into log and returns its sequence
+func (w *WAL) Append(s types.State) (uint64, error) {
+	return w.append(walRecord{State: s})
+}
+
+// append writes given record into log with the next sequence
+func (w *WAL) append(rc walRecord) (uint64, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	rc.Seq = w.next
+
+	var p []byte
+	if err := codec.NewEncoderBytes(&p, &w.h).Encode(rc); err != nil {
+		return 0, err
+	}
+
+	b := make([]byte, 8+len(p))
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(p)))
+	binary.BigEndian.PutUint32(b[4:8], crc32.ChecksumIEEE(p))
+	copy(b[8:], p)
+
+	if _, err := w.w.Write(b); err != nil {
+		return 0, err
+	}
+	if w.sync {
+		if err := w.w.Sync(); err != nil {
+			return 0, err
+		}
+	}
+
+	seq := w.next
+	w.next++
+	w.wSize += int64(len(b))
+
+	if w.wSize >= w.segmentSize {
+		if err := w.rotate(w.next); err != nil {
+			return 0, err
+		}
+	}
+
+	w.cond.Broadcast()
+
+	return seq, nil
+}
+
+// Next blocks until the next record is available and then returns it.
+// it returns errWALStopped when log reading is stopped.
+func (w *WAL) Next() (uint64, types.State, error) {
+	rc, err := w.nextRecord()
+	return rc.Seq, rc.State, err
+}
+
+// nextRecord blocks until the next record is available and then returns it
+func (w *WAL) nextRecord() (walRecord, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for {
+		if w.stopped {
+			return walRecord{}, errWALStopped
+		}
+
+		if w.rSeq < w.next {
+			rc, _, err := w.read(w.r)
+			if err == nil {
+				w.rSeq = rc.Seq + 1
+				// records before the checkpoint are already committed
+				if rc.Seq < w.committed {
+					continue
+				}
+				return rc, nil
+			}
+			if err == errWALCorrupted {
+				// records are sequential so the corrupted one has the next sequence,
+				// it is committed because there is nothing to pass into the pipeline.
+				stageErrors.WithLabelValues("wal", "corrupted").Inc()
+				w.commit(w.rSeq)
+				w.rSeq++
+				continue
+			}
+			if err != io.EOF {
+				return walRecord{}, err
+			}
+
+			// reader is behind the writer in the last segment so the rest of it cannot be read,
+			// writer moves into a new segment so the next records are readable.
+			if w.rSeg+1 == len(w.segments) {
+				if err := w.rotate(w.next); err != nil {
+					return walRecord{}, err
+				}
+			}
+
+			// current segment is finished so move to the next one, its unread records are lost
+			for ; w.rSeq < w.segments[w.rSeg+1]; w.rSeq++ {
+				stageErrors.WithLabelValues("wal", "corrupted").Inc()
+				w.commit(w.rSeq)
+			}
+			w.rSeg++
+			if err := w.openReader(); err != nil {
+				return walRecord{}, err
+			}
+			continue
+		}
+
+		w.cond.Wait()
+	}
+}
+
+// openReader opens reader segment file
+func (w *WAL) openReader() error {
+	if w.rFile != nil {
+		w.rFile.Close()
+	}
+
+	f, err := os.Open(w.segment(w.segments[w.rSeg]))
+	if err != nil {
+		return err
+	}
+	w.rFile = f
+	w.r = bufio.NewReader(f)
+
+	return nil
+}
+
+// read reads one record from given reader and returns it with its frame size
+func (w *WAL) read(r *bufio.Reader) (walRecord, int64, error) {
+	var rc walRecord
+
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return rc, 0, io.EOF
+		}
+		return rc, 0, err
+	}
+
+	l := binary.BigEndian.Uint32(hdr[0:4])
+	if l > maxWALRecordSize {
+		// length is corrupted so the next frames cannot be found
+		return rc, 0, io.EOF
+	}
+
+	p := make([]byte, l)
+	if _, err := io.ReadFull(r, p); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return rc, 0, io.EOF
+		}
+		return rc, 0, err
+	}
+	if crc32.ChecksumIEEE(p) != binary.BigEndian.Uint32(hdr[4:8]) {
+		return rc, int64(8 + len(p)), errWALCorrupted
+	}
+
+	if err := codec.NewDecoderBytes(p, &w.h).Decode(&rc); err != nil {
+		return rc, int64(8 + len(p)), errWALCorrupted
+	}
+
+	return rc, int64(8 + len(p)), nil
+}
+
+// Commit marks given sequence as done. checkpoint moves forward when all of
+// the sequences before it are committed and it is written to disk at most once per second.
+func (w *WAL) Commit(seq uint64) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.commit(seq)
+
+	if time.Since(w.checkpointTime) < time.Second {
+		return nil
+	}
+	return w.checkpoint()
+}
+
+// commit marks given sequence as done and moves the committed sequence forward
+func (w *WAL) commit(seq uint64) {
+	if seq < w.committed {
+		return
+	}
+
+	w.pending[seq] = true
+	for w.pending[w.committed] {
+		delete(w.pending, w.committed)
+		w.committed++
+	}
+}
+
+// checkpoint writes the committed sequence and removes segments that are fully committed
+func (w *WAL) checkpoint() error {
+	if w.checkpointed == w.committed {
+		return nil
+	}
+
+	tmp := filepath.Join(w.dir, "checkpoint.tmp")
+	if err := ioutil.WriteFile(tmp, []byte(strconv.FormatUint(w.committed, 10)), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(w.dir, "checkpoint")); err != nil {
+		return err
+	}
+	w.checkpointed = w.committed
+	w.checkpointTime = time.Now()
+
+	// segment i is fully committed when the segment after it starts before the checkpoint
+	n := 0
+	for n+1 < len(w.segments) && n < w.rSeg && w.segments[n+1] <= w.committed {
+		if err := os.Remove(w.segment(w.segments[n])); err != nil {
+			return err
+		}
+		n++
+	}
+	w.segments = w.segments[n:]
+	w.rSeg -= n
+
+	return nil
+}
+
+// Stop stops log reading so Next returns immediately. appending and committing are still possible.
+func (w *WAL) Stop() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.stopped = true
+	w.cond.Broadcast()
+}
+
+// Close writes the checkpoint and closes log files
+func (w *WAL) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.stopped = true
+	w.cond.Broadcast()
+
+	if err := w.checkpoint(); err != nil {
+		return err
+	}
+	if w.rFile != nil {
+		w.rFile.Close()
+	}
+	return w.w.Close()
+}
@@ -0,0 +1,206 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     wal_test.go
+ * +===============================================
+ */
+
+package core
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "link")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// small segments so each record has its own segment
+	w, err := OpenWAL(dir, 1, false)
+	assert.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		seq, err := w.Append(types.State{
+			Raw:     []byte{byte(i)},
+			At:      time.Now(),
+			Asset:   aName,
+			ThingID: tID,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(i), seq)
+	}
+
+	for i := 0; i < 4; i++ {
+		seq, s, err := w.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(i), seq)
+		assert.Equal(t, []byte{byte(i)}, s.Raw)
+	}
+
+	// out of order commits, checkpoint stays on the first uncommitted record
+	assert.NoError(t, w.Commit(0))
+	assert.NoError(t, w.Commit(2))
+	assert.NoError(t, w.Close())
+
+	w, err = OpenWAL(dir, 1, false)
+	assert.NoError(t, err)
+
+	for _, i := range []uint64{1, 2, 3} {
+		seq, _, err := w.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, i, seq)
+	}
+
+	seq, err := w.Append(types.State{Raw: 18.20, At: time.Now(), Asset: aName, ThingID: tID})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), seq)
+
+	w.Stop()
+	_, _, err = w.Next()
+	assert.Equal(t, errWALStopped, err)
+	assert.NoError(t, w.Close())
+}
+
+func TestWALTornTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "link")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := OpenWAL(dir, 1024*1024, true)
+	assert.NoError(t, err)
+	_, err = w.Append(types.State{Raw: 18.20, At: time.Now(), Asset: aName, ThingID: tID})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	// half written record
+	f, err := os.OpenFile(filepath.Join(dir, "00000000000000000000.wal"), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 100, 1, 2})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	w, err = OpenWAL(dir, 1024*1024, true)
+	assert.NoError(t, err)
+
+	seq, err := w.Append(types.State{Raw: 18.20, At: time.Now(), Asset: aName, ThingID: tID})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), seq)
+
+	for _, i := range []uint64{0, 1} {
+		seq, _, err := w.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, i, seq)
+	}
+	assert.NoError(t, w.Close())
+}
+
+func TestWALCorrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "link")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := OpenWAL(dir, 1024*1024, false)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := w.Append(types.State{Raw: []byte{byte(i)}, At: time.Now(), Asset: aName, ThingID: tID})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+
+	// flip a byte in the payload of the middle record
+	name := filepath.Join(dir, "00000000000000000000.wal")
+	b, err := ioutil.ReadFile(name)
+	assert.NoError(t, err)
+	first := 8 + int(binary.BigEndian.Uint32(b[0:4]))
+	b[first+10] ^= 0xff
+	assert.NoError(t, ioutil.WriteFile(name, b, 0644))
+
+	w, err = OpenWAL(dir, 1024*1024, false)
+	assert.NoError(t, err)
+
+	for _, i := range []uint64{0, 2} {
+		seq, s, err := w.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, i, seq)
+		assert.Equal(t, []byte{byte(i)}, s.Raw)
+	}
+
+	// corrupted record is committed so checkpoint moves after it
+	assert.NoError(t, w.Commit(0))
+	assert.NoError(t, w.Commit(2))
+	assert.Equal(t, uint64(3), w.committed)
+
+	// records that are appended after the corrupted one are read
+	seq, err := w.Append(types.State{Raw: 18.20, At: time.Now(), Asset: aName, ThingID: tID})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), seq)
+	seq, _, err = w.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), seq)
+	assert.NoError(t, w.Close())
+}
+
+func TestWALCorruptedLength(t *testing.T) {
+	dir, err := ioutil.TempDir("", "link")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := OpenWAL(dir, 1024*1024, false)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := w.Append(types.State{Raw: []byte{byte(i)}, At: time.Now(), Asset: aName, ThingID: tID})
+		assert.NoError(t, err)
+	}
+
+	// corrupt the length of the middle record so the rest of the segment cannot be read
+	f, err := os.OpenFile(filepath.Join(dir, "00000000000000000000.wal"), os.O_RDWR, 0644)
+	assert.NoError(t, err)
+	var hdr [4]byte
+	_, err = f.ReadAt(hdr[:], 0)
+	assert.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, 8+int64(binary.BigEndian.Uint32(hdr[:])))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	seq, _, err := w.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), seq)
+
+	// writer moves into a new segment when reader reaches the corrupted record
+	// and the lost records are committed
+	next := make(chan uint64)
+	go func() {
+		seq, _, err := w.Next()
+		assert.NoError(t, err)
+		next <- seq
+	}()
+	for rotated := false; !rotated; time.Sleep(time.Millisecond) {
+		w.lock.Lock()
+		rotated = len(w.segments) == 2
+		w.lock.Unlock()
+	}
+
+	seq, err = w.Append(types.State{Raw: 18.20, At: time.Now(), Asset: aName, ThingID: tID})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), seq)
+	assert.Equal(t, uint64(3), <-next)
+
+	assert.NoError(t, w.Commit(0))
+	assert.Equal(t, uint64(3), w.committed)
+	assert.NoError(t, w.Close())
+}
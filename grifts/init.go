@@ -6,5 +6,6 @@ import (
 )
 
 func init() {
-	buffalo.Grifts(actions.App())
+	// grifts do not handle any request so they do not need core application
+	buffalo.Grifts(actions.App(nil))
 }
@@ -11,16 +11,23 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
-	"runtime"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/FANIoT/link/actions"
+	"github.com/FANIoT/link/core"
 	"github.com/FANIoT/link/mqtt"
+	"github.com/gobuffalo/envy"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -29,26 +36,85 @@ func main() {
 	var isHeadless = flag.Bool("headless", false, "Runs link in headless mode. In headless mode link just has its mqtt service")
 	flag.Parse()
 
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+
+	// core application is shared between all of the link services
+	// so they have the same pipeline
+	coreApp := core.New()
+	coreApp.Run()
+
+	var srv *http.Server
 	if !*isHeadless {
 		// buffalo http service
+		app := actions.App(coreApp)
+
+		// http service is ready when its listener is bound so
+		// other services can start after it without any waiting.
+		network, addr := "tcp", app.Options.Addr
+		if strings.HasPrefix(addr, "unix:") {
+			network, addr = "unix", addr[5:]
+		}
+		l, err := net.Listen(network, addr)
+		if err != nil {
+			log.Fatalf("Buffalo Service failed with %s", err)
+		}
+
+		srv = &http.Server{
+			Handler: app,
+		}
 		go func() {
-			app := actions.App()
-			if err := app.Serve(); err != nil {
+			if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
 				log.Fatalf("Buffalo Service failed with %s", err)
 			}
 		}()
-		runtime.Gosched()
-		// we must wait for http service to go online before starting the
-		// services. maybe in the future we change this behaviour.
-		fmt.Println("Wait for http service to really start")
-		time.Sleep(10 * time.Second)
+		fmt.Printf("HTTP service is ready on %s\n", app.Options.Addr)
+	} else if addr := envy.Get("METRICS_ADDR", ":1373"); addr != "" {
+		// in headless mode there is no buffalo service so metrics
+		// are served by a standalone listener
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		srv = &http.Server{
+			Addr:    addr,
+			Handler: mux,
+		}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Metrics Service failed with %s", err)
+			}
+		}()
+		fmt.Printf("Metrics service is ready on %s\n", addr)
 	}
+
 	// non-http services
-	if err := mqtt.New().Run(); err != nil {
+	ms := mqtt.New(coreApp)
+	if err := ms.Run(); err != nil {
 		log.Fatalf("MQTT Service failed with %s", err)
 	}
 
-	sigc := make(chan os.Signal, 1)
-	signal.Notify(sigc, os.Interrupt)
-	<-sigc
+	s := <-sigc
+	fmt.Printf("Shutting down because of %s\n", s)
+
+	timeout, err := time.ParseDuration(envy.Get("SHUTDOWN_TIMEOUT", "30s"))
+	if err != nil {
+		log.Fatalf("Shutdown timeout parse error: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	// stop ingress services then drain the pipeline
+	code := 0
+	if srv != nil {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("HTTP service shutdown failed with %s", err)
+			code = 1
+		}
+	}
+	ms.Exit()
+	if err := coreApp.ExitContext(ctx); err != nil {
+		log.Printf("Core application shutdown failed with %s", err)
+		code = 1
+	}
+
+	cancel()
+	os.Exit(code)
 }
@@ -0,0 +1,77 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     command.go
+ * +===============================================
+ */
+
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/FANIoT/link/core"
+	"github.com/FANIoT/types"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+)
+
+// Name returns mqtt connectivity name
+func (s *Service) Name() string {
+	return "mqtt"
+}
+
+// Deliver publishes command payload on the following topic
+// things/{thing_id}/commands/{command_id}
+// devices subscribe on things/{thing_id}/commands/+ so they know the command identification
+// and they can acknowledge it. commands may be published more than once until their acknowledgement.
+func (s *Service) Deliver(_ context.Context, t types.Thing, c core.Command) (core.CommandStatus, error) {
+	if s.cli == nil || !s.cli.IsConnected() {
+		return core.CommandQueued, fmt.Errorf("MQTT service is not connected")
+	}
+
+	if tk := s.cli.Publish(fmt.Sprintf("things/%s/commands/%s", t.ID, c.ID), 1, false, c.Payload); tk.Wait() && tk.Error() != nil {
+		return core.CommandQueued, tk.Error()
+	}
+
+	return core.CommandSent, nil
+}
+
+// AcksCommands marks mqtt as a connectivity that things acknowledge its commands,
+// so its sent commands are published again until their acknowledgement.
+func (s *Service) AcksCommands() {}
+
+// ackFilter returns subscription filter of commands acknowledgements
+func (s *Service) ackFilter() string {
+	f := "things/+/commands/+/ack"
+	if s.group != "" {
+		f = fmt.Sprintf("$share/%s/%s", s.group, f)
+	}
+	return f
+}
+
+// ackHandler handles commands acknowledgements on the following topic
+// things/{thing_id}/commands/{command_id}/ack
+func (s *Service) ackHandler(client paho.Client, message paho.Message) {
+	levels := strings.Split(message.Topic(), "/")
+	if len(levels) < 5 {
+		return
+	}
+	thingID := levels[len(levels)-4]
+	commandID := levels[len(levels)-2]
+
+	if err := s.app.AckCommand(context.Background(), thingID, commandID); err != nil {
+		s.app.Logger.WithFields(logrus.Fields{
+			"component": "mqtt service",
+			"topic":     message.Topic(),
+		}).Errorf("Command ack error: %s", err)
+	}
+}
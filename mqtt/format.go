@@ -0,0 +1,219 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     format.go
+ * +===============================================
+ */
+
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/FANIoT/link/senml"
+	"github.com/ugorji/go/codec"
+)
+
+// Format is a payload format of incoming mqtt messages
+type Format string
+
+// Payload formats
+const (
+	FormatJSON      Format = "json"
+	FormatCBOR      Format = "cbor"
+	FormatMsgPack   Format = "msgpack"
+	FormatBinary    Format = "binary" // opaque payload that is decoded by thing model
+	FormatSenMLJSON Format = "senml+json"
+	FormatSenMLCBOR Format = "senml+cbor"
+)
+
+// RawAsset is the asset of opaque binary payloads on topics without asset variable.
+// thing models usually decode them into many assets.
+const RawAsset = "raw"
+
+// ParseFormat validates given format name
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case FormatJSON, FormatCBOR, FormatMsgPack, FormatBinary, FormatSenMLJSON, FormatSenMLCBOR:
+		return f, nil
+	default:
+		return "", fmt.Errorf("Format %s is not supported", name)
+	}
+}
+
+// payload is a state of one asset in incoming mqtt messages
+type payload struct {
+	At    time.Time
+	Value interface{}
+}
+
+// reading is a decoded state of an asset
+type reading struct {
+	Asset string
+	payload
+}
+
+// readings converts map of assets to their state into readings
+func readings(ps map[string]payload) []reading {
+	rs := make([]reading, 0, len(ps))
+	for name, p := range ps {
+		rs = append(rs, reading{
+			Asset:   name,
+			payload: p,
+		})
+	}
+	return rs
+}
+
+// codecPayload is a state of one asset in cbor and msgpack messages.
+// its time can be a timestamp, unix time in seconds or rfc3339 string.
+type codecPayload struct {
+	At    interface{} `codec:"at"`
+	Value interface{} `codec:"value"`
+}
+
+// payload converts codec payload into payload
+func (p codecPayload) payload() (payload, error) {
+	var at time.Time
+
+	switch v := p.At.(type) {
+	case nil:
+	case time.Time:
+		at = v
+	case int64:
+		at = time.Unix(v, 0)
+	case uint64:
+		at = time.Unix(int64(v), 0)
+	case float64:
+		at = time.Unix(0, int64(v*float64(time.Second)))
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return payload{}, err
+		}
+		at = t
+	default:
+		return payload{}, fmt.Errorf("invalid time %v", v)
+	}
+
+	return payload{
+		At:    at,
+		Value: p.Value,
+	}, nil
+}
+
+// handle returns codec handle of cbor and msgpack formats
+func handle(f Format) codec.Handle {
+	mapType := reflect.TypeOf(map[string]interface{}(nil))
+
+	switch f {
+	case FormatCBOR:
+		h := new(codec.CborHandle)
+		h.MapType = mapType
+		return h
+	case FormatMsgPack:
+		h := new(codec.MsgpackHandle)
+		h.MapType = mapType
+		h.RawToString = true
+		return h
+	}
+	return nil
+}
+
+// decode decodes given payload based on its format. payload contains state of given asset
+// when asset is not empty, otherwise it contains a map of assets to their state.
+// SenML payloads have their assets in their records names so they ignore the given asset.
+func decode(f Format, b []byte, asset string) ([]reading, error) {
+	switch f {
+	case FormatBinary:
+		if asset == "" {
+			asset = RawAsset
+		}
+		return []reading{
+			{
+				Asset: asset,
+				payload: payload{
+					Value: b,
+				},
+			},
+		}, nil
+	case FormatJSON:
+		if asset != "" {
+			var p payload
+			if err := json.Unmarshal(b, &p); err != nil {
+				return nil, err
+			}
+			return readings(map[string]payload{
+				asset: p,
+			}), nil
+		}
+
+		var ps map[string]payload
+		if err := json.Unmarshal(b, &ps); err != nil {
+			return nil, err
+		}
+		return readings(ps), nil
+	case FormatCBOR, FormatMsgPack:
+		var cps map[string]codecPayload
+		if asset != "" {
+			var cp codecPayload
+			if err := codec.NewDecoderBytes(b, handle(f)).Decode(&cp); err != nil {
+				return nil, err
+			}
+			cps = map[string]codecPayload{
+				asset: cp,
+			}
+		} else if err := codec.NewDecoderBytes(b, handle(f)).Decode(&cps); err != nil {
+			return nil, err
+		}
+
+		ps := make(map[string]payload, len(cps))
+		for name, cp := range cps {
+			p, err := cp.payload()
+			if err != nil {
+				return nil, fmt.Errorf("Asset %s: %s", name, err)
+			}
+			ps[name] = p
+		}
+		return readings(ps), nil
+	case FormatSenMLJSON, FormatSenMLCBOR:
+		var p senml.Pack
+		var err error
+		if f == FormatSenMLJSON {
+			p, err = senml.DecodeJSON(b)
+		} else {
+			p, err = senml.DecodeCBOR(b)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ms, err := p.Resolve(time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		rs := make([]reading, 0, len(ms))
+		for _, m := range ms {
+			rs = append(rs, reading{
+				Asset: m.Asset,
+				payload: payload{
+					At:    m.Time,
+					Value: m.Value,
+				},
+			})
+		}
+		return rs, nil
+	default:
+		return nil, fmt.Errorf("Format %s is not supported", f)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     format_test.go
+ * +===============================================
+ */
+
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	rs, err := decode(FormatJSON, []byte(`{"temperature": {"at": "2018-10-18T10:20:00Z", "value": 18.20}}`), "")
+	assert.NoError(t, err)
+	assert.Len(t, rs, 1)
+	assert.Equal(t, "temperature", rs[0].Asset)
+	assert.Equal(t, 18.20, rs[0].Value)
+	assert.Equal(t, time.Date(2018, 10, 18, 10, 20, 0, 0, time.UTC), rs[0].At.UTC())
+
+	rs, err = decode(FormatJSON, []byte(`{"value": true}`), "light")
+	assert.NoError(t, err)
+	assert.Len(t, rs, 1)
+	assert.Equal(t, "light", rs[0].Asset)
+	assert.Equal(t, true, rs[0].Value)
+	assert.True(t, rs[0].At.IsZero())
+}
+
+func TestDecodeCodec(t *testing.T) {
+	for _, f := range []Format{FormatCBOR, FormatMsgPack} {
+		var b []byte
+		assert.NoError(t, codec.NewEncoderBytes(&b, handle(f)).Encode(map[string]interface{}{
+			"temperature": map[string]interface{}{
+				"at":    1539858000,
+				"value": 18.20,
+			},
+		}))
+
+		rs, err := decode(f, b, "")
+		assert.NoError(t, err, f)
+		assert.Len(t, rs, 1, f)
+		assert.Equal(t, 18.20, rs[0].Value, f)
+		assert.Equal(t, time.Unix(1539858000, 0), rs[0].At, f)
+	}
+}
+
+func TestDecodeBinary(t *testing.T) {
+	rs, err := decode(FormatBinary, []byte{0x18, 0x20}, "")
+	assert.NoError(t, err)
+	assert.Len(t, rs, 1)
+	assert.Equal(t, RawAsset, rs[0].Asset)
+	assert.Equal(t, []byte{0x18, 0x20}, rs[0].Value)
+
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestDecodeSenML(t *testing.T) {
+	rs, err := decode(FormatSenMLJSON, []byte(`[{"bn": "0:", "bt": 1539858000, "n": "temperature", "u": "Cel", "v": 18.20}, {"n": "temperature", "t": 60, "v": 18.21}]`), "")
+	assert.NoError(t, err)
+	assert.Len(t, rs, 2)
+	assert.Equal(t, "temperature", rs[1].Asset)
+	assert.Equal(t, 18.21, rs[1].Value)
+	assert.Equal(t, time.Unix(1539858060, 0), rs[1].At)
+}
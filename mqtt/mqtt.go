@@ -14,13 +14,13 @@
 package mqtt
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"math/rand"
-	"strings"
 	"time"
 
 	"github.com/FANIoT/link/core"
+	"github.com/FANIoT/link/pm"
 	"github.com/FANIoT/types"
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gobuffalo/envy"
@@ -37,31 +37,84 @@ func init() {
 type Service struct {
 	cli paho.Client
 	app *core.Application
+
+	// handler waits at most timeout for passing each state into application
+	timeout time.Duration
+
+	// service subscribes on these topics with the shared subscription group
+	topics []*Topic
+	group  string
+
+	// format of payloads when topic and thing do not specify it
+	format Format
 }
 
-// New creates new mqtt service
-func New() *Service {
+// New creates new mqtt service on the given core application.
+// core application is shared between all of the link services so it
+// is created and run by the caller.
+func New(a *core.Application) *Service {
 	s := Service{}
-	s.app = core.New()
+	s.app = a
+
+	timeout, err := time.ParseDuration(envy.Get("MQTT_DATA_TIMEOUT", "1s"))
+	if err != nil {
+		s.app.Logger.Fatalf("MQTT data timeout parse error: %s", err)
+	}
+	s.timeout = timeout
+
+	topics, err := TopicsFromEnv()
+	if err != nil {
+		s.app.Logger.Fatalf("MQTT topics parse error: %s", err)
+	}
+	s.topics = topics
+	s.group = envy.Get("MQTT_SHARE_GROUP", "i1820-link")
+
+	format, err := ParseFormat(envy.Get("MQTT_FORMAT", string(FormatJSON)))
+	if err != nil {
+		s.app.Logger.Fatalf("MQTT format parse error: %s", err)
+	}
+	s.format = format
+
+	// commands are delivered over user broker
+	a.RegisterDeliverer(&s)
 
 	return &s
 }
 
-// handler handles incoming mqtt messages for following topic
-// /things/{thing_id}/state
+// handler handles incoming mqtt messages on the service topics e.g.
+// things/{thing_id}/state that has a map of assets to their state or
+// things/{thing_id}/assets/{asset}/state that has state of one asset.
+// payload format is specified by format variable of topic or thing configuration.
 func (s *Service) handler(client paho.Client, message paho.Message) {
-	thingID := strings.Split(message.Topic(), "/")[1]
+	t, vars, ok := MatchTopics(s.topics, message.Topic())
+	if !ok {
+		s.app.Logger.WithFields(logrus.Fields{
+			"component": "mqtt service",
+			"topic":     message.Topic(),
+		}).Errorf("Topic does not match any of %v", s.topics)
+		return
+	}
+
+	f, err := s.formatOf(vars)
+	if err != nil {
+		s.app.Logger.WithFields(logrus.Fields{
+			"component": "mqtt service",
+			"topic":     message.Topic(),
+		}).Errorf("Format error: %s", err)
+		return
+	}
 
-	var states map[string]struct {
-		At    time.Time
-		Value interface{}
+	var asset string
+	if t.Has(AssetVar) {
+		asset = vars[AssetVar]
 	}
 
-	if err := json.Unmarshal(message.Payload(), &states); err != nil {
+	states, err := decode(f, message.Payload(), asset)
+	if err != nil {
 		s.app.Logger.WithFields(logrus.Fields{
 			"component": "mqtt service",
 			"topic":     message.Topic(),
-		}).Errorf("Marshal error %s: %s", err, message.Payload())
+		}).Errorf("Marshal error %s: %q", err, message.Payload())
 		return
 	}
 	s.app.Logger.WithFields(logrus.Fields{
@@ -69,12 +122,21 @@ func (s *Service) handler(client paho.Client, message paho.Message) {
 		"topic":     message.Topic(),
 	}).Infof("Marshal on %v", states)
 
-	for name, state := range states {
-		if err := s.app.Data(types.State{
+	// paho calls handler in its own goroutine so it must not be blocked by a slow pipeline
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	for _, state := range states {
+		if state.At.IsZero() {
+			state.At = time.Now()
+		}
+
+		if err := s.app.DataContext(ctx, types.State{
 			Raw:     state.Value,
 			At:      state.At,
-			ThingID: thingID,
-			Asset:   name,
+			ThingID: vars[ThingIDVar],
+			Project: vars[ProjectVar],
+			Asset:   state.Asset,
 		}); err != nil {
 			s.app.Logger.WithFields(logrus.Fields{
 				"component": "mqtt service",
@@ -101,7 +163,10 @@ func (s *Service) Run() error {
 	opts.SetUsername(envy.Get("USR_BROKER_USER", "ella"))
 	opts.SetClientID(fmt.Sprintf("FANIoT-mqs-link-%d", rand.Intn(1024)))
 	opts.SetOnConnectHandler(func(client paho.Client) {
-		if t := s.cli.Subscribe("$share/i1820-link/things/+/state", 0, s.handler); t.Wait() && t.Error() != nil {
+		if t := s.cli.SubscribeMultiple(s.filters(), s.handler); t.Wait() && t.Error() != nil {
+			s.app.Logger.Fatalf("MQTT subscribe error: %s", t.Error())
+		}
+		if t := s.cli.Subscribe(s.ackFilter(), 1, s.ackHandler); t.Wait() && t.Error() != nil {
 			s.app.Logger.Fatalf("MQTT subscribe error: %s", t.Error())
 		}
 	})
@@ -111,7 +176,44 @@ func (s *Service) Run() error {
 	if t := s.cli.Connect(); t.Wait() && t.Error() != nil {
 		return t.Error()
 	}
-	s.app.Run()
 
 	return nil
 }
+
+// formatOf returns payload format of message based on its topic variables
+// or its thing configuration in pm
+func (s *Service) formatOf(vars map[string]string) (Format, error) {
+	if name, ok := vars[FormatVar]; ok {
+		return ParseFormat(name)
+	}
+
+	name, err := pm.FormatByThingID(context.Background(), vars[ThingIDVar])
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return s.format, nil
+	}
+	return ParseFormat(name)
+}
+
+// filters returns subscription filters of service topics, filters are shared between
+// link instances in the shared subscription group when it is not empty
+func (s *Service) filters() map[string]byte {
+	filters := make(map[string]byte)
+	for _, t := range s.topics {
+		f := t.Filter()
+		if s.group != "" {
+			f = fmt.Sprintf("$share/%s/%s", s.group, f)
+		}
+		filters[f] = 0
+	}
+	return filters
+}
+
+// Exit stops receiving new messages
+func (s *Service) Exit() {
+	// disconnect waiting time in milliseconds
+	var quiesce uint = 250
+	s.cli.Disconnect(quiesce)
+}
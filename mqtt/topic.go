@@ -0,0 +1,164 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     topic.go
+ * +===============================================
+ */
+
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gobuffalo/envy"
+)
+
+// Topic variables
+const (
+	ThingIDVar = "thing_id"
+	AssetVar   = "asset"
+	ProjectVar = "project"
+	FormatVar  = "format"
+)
+
+// Topic is a parsed topic template like things/{thing_id}/assets/{asset}/state.
+// each level of template is a literal or a named variable and each variable
+// matches exactly one level of topic.
+type Topic struct {
+	template string
+	levels   []string
+	vars     map[int]string // variable name of each level index
+}
+
+// ParseTopic parses given topic template. template must have thing_id variable
+// and its other variables must be asset, project or format.
+func ParseTopic(template string) (*Topic, error) {
+	t := &Topic{
+		template: template,
+		levels:   strings.Split(template, "/"),
+		vars:     make(map[int]string),
+	}
+
+	for i, l := range t.levels {
+		if strings.ContainsAny(l, "+#") {
+			return nil, fmt.Errorf("Topic %s must not have wildcards", template)
+		}
+		if !strings.HasPrefix(l, "{") || !strings.HasSuffix(l, "}") {
+			if strings.ContainsAny(l, "{}") {
+				return nil, fmt.Errorf("Topic %s has invalid level %s", template, l)
+			}
+			continue
+		}
+
+		name := l[1 : len(l)-1]
+		switch name {
+		case ThingIDVar, AssetVar, ProjectVar, FormatVar:
+		default:
+			return nil, fmt.Errorf("Topic %s has unknown variable %s", template, name)
+		}
+		for _, v := range t.vars {
+			if v == name {
+				return nil, fmt.Errorf("Topic %s has duplicate variable %s", template, name)
+			}
+		}
+		t.vars[i] = name
+	}
+
+	if !t.Has(ThingIDVar) {
+		return nil, fmt.Errorf("Topic %s must have %s variable", template, ThingIDVar)
+	}
+
+	return t, nil
+}
+
+// TopicsFromEnv parses comma separated topic templates of MQTT_TOPICS environment variable
+func TopicsFromEnv() ([]*Topic, error) {
+	var ts []*Topic
+
+	for _, template := range strings.Split(envy.Get("MQTT_TOPICS", "things/{thing_id}/state"), ",") {
+		template = strings.TrimSpace(template)
+		if template == "" {
+			continue
+		}
+
+		t, err := ParseTopic(template)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+
+	if len(ts) == 0 {
+		return nil, fmt.Errorf("There is no MQTT topic")
+	}
+
+	return ts, nil
+}
+
+// String returns topic template
+func (t *Topic) String() string {
+	return t.template
+}
+
+// Has returns true when topic has given variable
+func (t *Topic) Has(name string) bool {
+	for _, v := range t.vars {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns subscription filter of topic that has single level wildcard instead of each variable
+func (t *Topic) Filter() string {
+	levels := make([]string, len(t.levels))
+	for i, l := range t.levels {
+		if _, ok := t.vars[i]; ok {
+			l = "+"
+		}
+		levels[i] = l
+	}
+	return strings.Join(levels, "/")
+}
+
+// Match matches given topic with template and returns its variables
+func (t *Topic) Match(topic string) (map[string]string, bool) {
+	levels := strings.Split(topic, "/")
+	if len(levels) != len(t.levels) {
+		return nil, false
+	}
+
+	vars := make(map[string]string)
+	for i, l := range levels {
+		if name, ok := t.vars[i]; ok {
+			if l == "" {
+				return nil, false
+			}
+			vars[name] = l
+			continue
+		}
+		if l != t.levels[i] {
+			return nil, false
+		}
+	}
+
+	return vars, true
+}
+
+// MatchTopics matches given topic with the first matching template
+func MatchTopics(ts []*Topic, topic string) (*Topic, map[string]string, bool) {
+	for _, t := range ts {
+		if vars, ok := t.Match(topic); ok {
+			return t, vars, true
+		}
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,63 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     topic_test.go
+ * +===============================================
+ */
+
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTopic(t *testing.T) {
+	_, err := ParseTopic("things/+/state")
+	assert.Error(t, err)
+
+	_, err = ParseTopic("assets/{asset}/state")
+	assert.Error(t, err)
+
+	_, err = ParseTopic("things/{thing}/state")
+	assert.Error(t, err)
+
+	_, err = ParseTopic("things/{thing_id}/{thing_id}")
+	assert.Error(t, err)
+
+	tp, err := ParseTopic("projects/{project}/things/{thing_id}/assets/{asset}/state")
+	assert.NoError(t, err)
+	assert.Equal(t, "projects/+/things/+/assets/+/state", tp.Filter())
+	assert.True(t, tp.Has(AssetVar))
+}
+
+func TestMatchTopics(t *testing.T) {
+	t1, err := ParseTopic("things/{thing_id}/state")
+	assert.NoError(t, err)
+	t2, err := ParseTopic("things/{thing_id}/assets/{asset}/state")
+	assert.NoError(t, err)
+	ts := []*Topic{t1, t2}
+
+	tp, vars, ok := MatchTopics(ts, "things/0/state")
+	assert.True(t, ok)
+	assert.Equal(t, t1, tp)
+	assert.Equal(t, map[string]string{ThingIDVar: "0"}, vars)
+
+	tp, vars, ok = MatchTopics(ts, "things/0/assets/temperature/state")
+	assert.True(t, ok)
+	assert.Equal(t, t2, tp)
+	assert.Equal(t, map[string]string{ThingIDVar: "0", AssetVar: "temperature"}, vars)
+
+	_, _, ok = MatchTopics(ts, "things//state")
+	assert.False(t, ok)
+
+	_, _, ok = MatchTopics(ts, "things/0/commands")
+	assert.False(t, ok)
+}
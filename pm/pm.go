@@ -42,32 +42,69 @@ func init() {
 
 }
 
-// ThingByID finds thing by its id in pm component database.
-func ThingByID(ctx context.Context, id string) (types.Thing, error) {
+// NotFoundError is returned when thing is not found or it is not activated
+type NotFoundError struct {
+	ID string
+}
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("Thing %s not found", e.ID)
+}
+
+// thing is an activated thing with its attributes that are stored beside it
+// in pm component database but are not part of types.Thing.
+type thing struct {
+	types.Thing
+	Script   string            `bson:"script"`
+	Format   string            `bson:"format"`
+	Virtuals map[string]string `bson:"virtuals"`
+}
+
+// thingByID finds thing and its attributes by its id in pm component database.
+// all of them are cached together so each thing is fetched once.
+func thingByID(ctx context.Context, id string) (thing, error) {
 	// check cache in the first place
 	if th, found := c.Get(id); found {
-		return th.(types.Thing), nil
+		return th.(thing), nil
 	}
 
-	var t types.Thing
+	var t thing
 	// find things by its id (please note that it must be activated)
+	d := bson.NewDocument()
 	dr := db.Collection("things").FindOne(ctx, bson.NewDocument(
 		bson.EC.Boolean("status", true),
 		bson.EC.String("_id", id),
 	))
-	if err := dr.Decode(&t); err != nil {
+	if err := dr.Decode(d); err != nil {
 		if err == mgo.ErrNoDocuments {
-			return t, fmt.Errorf("Thing %s not found", id)
+			return t, NotFoundError{ID: id}
 		}
 		return t, err
 	}
 
+	b, err := d.MarshalBSON()
+	if err != nil {
+		return t, err
+	}
+	if err := bson.Unmarshal(b, &t); err != nil {
+		return t, err
+	}
+	if err := bson.Unmarshal(b, &t.Thing); err != nil {
+		return t, err
+	}
+
 	// Set the value of the key thing_id to thing, with the default expiration time
 	c.Set(id, t, cache.DefaultExpiration)
 
 	return t, nil
 }
 
+// ThingByID finds thing by its id in pm component database.
+func ThingByID(ctx context.Context, id string) (types.Thing, error) {
+	t, err := thingByID(ctx, id)
+	return t.Thing, err
+}
+
 // ThingsByProject finds all things that belong to given project id
 // please note that this function cache all things by their project id
 func ThingsByProject(ctx context.Context, id string) ([]types.Thing, error) {
@@ -103,3 +140,36 @@ func ThingsByProject(ctx context.Context, id string) ([]types.Thing, error) {
 
 	return ts, err
 }
+
+// ScriptByThingID finds decode script of thing that uses generic model.
+// scripts are stored beside their things in pm component database.
+func ScriptByThingID(ctx context.Context, id string) (string, error) {
+	t, err := thingByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if t.Script == "" {
+		return "", fmt.Errorf("Thing %s does not have any script", id)
+	}
+	return t.Script, nil
+}
+
+// FormatByThingID finds mqtt payload format of thing. formats are stored beside their things
+// in pm component database and it returns an empty string for things without any format.
+func FormatByThingID(ctx context.Context, id string) (string, error) {
+	t, err := thingByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return t.Format, nil
+}
+
+// VirtualsByThingID finds virtual assets of thing. virtual assets are stored beside their things
+// in pm component database and they map each virtual asset to its expression on other assets.
+func VirtualsByThingID(ctx context.Context, id string) (map[string]string, error) {
+	t, err := thingByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return t.Virtuals, nil
+}
@@ -0,0 +1,491 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     senml.go
+ * +===============================================
+ */
+
+// Package senml implements Sensor Measurement Lists (RFC 8428) in JSON and CBOR
+// and maps their records to link states.
+package senml
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/ugorji/go/codec"
+)
+
+// Media types of SenML
+const (
+	JSONContentType = "application/senml+json"
+	CBORContentType = "application/senml+cbor"
+)
+
+// Version is the SenML version that is supported
+const Version = 10
+
+// relativeTime is the threshold of relative times, times before it are relative to now
+const relativeTime = 1 << 28
+
+// Record is a SenML record. base fields are applied on the record and all of the records after it.
+// data values are base64url strings in JSON and byte strings in CBOR.
+type Record struct {
+	BaseName    string   `json:"bn,omitempty"`
+	BaseTime    float64  `json:"bt,omitempty"`
+	BaseUnit    string   `json:"bu,omitempty"`
+	BaseValue   *float64 `json:"bv,omitempty"`
+	BaseSum     *float64 `json:"bs,omitempty"`
+	BaseVersion int      `json:"bver,omitempty"`
+
+	Name        string   `json:"n,omitempty"`
+	Unit        string   `json:"u,omitempty"`
+	Value       *float64 `json:"v,omitempty"`
+	StringValue *string  `json:"vs,omitempty"`
+	BoolValue   *bool    `json:"vb,omitempty"`
+	DataValue   *string  `json:"vd,omitempty"`
+	Sum         *float64 `json:"s,omitempty"`
+	Time        float64  `json:"t,omitempty"`
+	UpdateTime  float64  `json:"ut,omitempty"`
+}
+
+// Pack is a list of SenML records
+type Pack []Record
+
+// Measurement is a resolved record that has its full name, unit, absolute time and value.
+// value is one of float64, string, bool or []byte.
+type Measurement struct {
+	Name  string
+	Unit  string
+	Time  time.Time
+	Value interface{}
+	Sum   *float64
+
+	// Asset is the record name without base name
+	Asset string
+}
+
+// CBOR labels of SenML fields
+const (
+	labelBaseVersion = -1
+	labelBaseName    = -2
+	labelBaseTime    = -3
+	labelBaseUnit    = -4
+	labelBaseValue   = -5
+	labelBaseSum     = -6
+	labelName        = 0
+	labelUnit        = 1
+	labelValue       = 2
+	labelStringValue = 3
+	labelBoolValue   = 4
+	labelSum         = 5
+	labelTime        = 6
+	labelUpdateTime  = 7
+	labelDataValue   = 8
+)
+
+// cborHandle returns handle of SenML CBOR representation
+func cborHandle() *codec.CborHandle {
+	h := new(codec.CborHandle)
+	h.MapType = reflect.TypeOf(map[int]interface{}(nil))
+	return h
+}
+
+// DecodeJSON decodes SenML JSON representation
+func DecodeJSON(b []byte) (Pack, error) {
+	var p Pack
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// EncodeJSON encodes pack into SenML JSON representation
+func EncodeJSON(p Pack) ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// DecodeCBOR decodes SenML CBOR representation that uses integer labels
+func DecodeCBOR(b []byte) (Pack, error) {
+	var ms []map[int]interface{}
+	if err := codec.NewDecoderBytes(b, cborHandle()).Decode(&ms); err != nil {
+		return nil, err
+	}
+
+	p := make(Pack, 0, len(ms))
+	for i, m := range ms {
+		var r Record
+		for l, v := range m {
+			if err := r.set(l, v); err != nil {
+				return nil, fmt.Errorf("Record %d: %s", i, err)
+			}
+		}
+		p = append(p, r)
+	}
+
+	return p, nil
+}
+
+// EncodeCBOR encodes pack into SenML CBOR representation that uses integer labels
+func EncodeCBOR(p Pack) ([]byte, error) {
+	ms := make([]map[int]interface{}, 0, len(p))
+	for _, r := range p {
+		m, err := r.labels()
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+
+	var b []byte
+	if err := codec.NewEncoderBytes(&b, cborHandle()).Encode(ms); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Decode decodes pack based on given SenML media type
+func Decode(b []byte, contentType string) (Pack, error) {
+	switch contentType {
+	case JSONContentType:
+		return DecodeJSON(b)
+	case CBORContentType:
+		return DecodeCBOR(b)
+	default:
+		return nil, fmt.Errorf("Content type %s is not SenML", contentType)
+	}
+}
+
+// set sets field of given CBOR label
+func (r *Record) set(label int, v interface{}) error {
+	var err error
+
+	switch label {
+	case labelBaseVersion:
+		var f float64
+		f, err = number(v)
+		r.BaseVersion = int(f)
+	case labelBaseName:
+		r.BaseName, err = text(v)
+	case labelBaseTime:
+		r.BaseTime, err = number(v)
+	case labelBaseUnit:
+		r.BaseUnit, err = text(v)
+	case labelBaseValue:
+		r.BaseValue, err = numberRef(v)
+	case labelBaseSum:
+		r.BaseSum, err = numberRef(v)
+	case labelName:
+		r.Name, err = text(v)
+	case labelUnit:
+		r.Unit, err = text(v)
+	case labelValue:
+		r.Value, err = numberRef(v)
+	case labelStringValue:
+		var s string
+		s, err = text(v)
+		r.StringValue = &s
+	case labelBoolValue:
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("invalid boolean %v", v)
+		}
+		r.BoolValue = &b
+	case labelSum:
+		r.Sum, err = numberRef(v)
+	case labelTime:
+		r.Time, err = number(v)
+	case labelUpdateTime:
+		r.UpdateTime, err = number(v)
+	case labelDataValue:
+		b, ok := v.([]byte)
+		if !ok {
+			return fmt.Errorf("invalid data %v", v)
+		}
+		s := base64.RawURLEncoding.EncodeToString(b)
+		r.DataValue = &s
+	default:
+		// unknown fields are ignored but fields that must be understood end with _
+		// and they do not have integer labels
+	}
+
+	return err
+}
+
+// labels returns record fields by their CBOR labels
+func (r Record) labels() (map[int]interface{}, error) {
+	m := make(map[int]interface{})
+
+	if r.BaseVersion != 0 {
+		m[labelBaseVersion] = r.BaseVersion
+	}
+	if r.BaseName != "" {
+		m[labelBaseName] = r.BaseName
+	}
+	if r.BaseTime != 0 {
+		m[labelBaseTime] = r.BaseTime
+	}
+	if r.BaseUnit != "" {
+		m[labelBaseUnit] = r.BaseUnit
+	}
+	if r.BaseValue != nil {
+		m[labelBaseValue] = *r.BaseValue
+	}
+	if r.BaseSum != nil {
+		m[labelBaseSum] = *r.BaseSum
+	}
+	if r.Name != "" {
+		m[labelName] = r.Name
+	}
+	if r.Unit != "" {
+		m[labelUnit] = r.Unit
+	}
+	if r.Value != nil {
+		m[labelValue] = *r.Value
+	}
+	if r.StringValue != nil {
+		m[labelStringValue] = *r.StringValue
+	}
+	if r.BoolValue != nil {
+		m[labelBoolValue] = *r.BoolValue
+	}
+	if r.DataValue != nil {
+		b, err := base64.RawURLEncoding.DecodeString(*r.DataValue)
+		if err != nil {
+			return nil, err
+		}
+		m[labelDataValue] = b
+	}
+	if r.Sum != nil {
+		m[labelSum] = *r.Sum
+	}
+	if r.Time != 0 {
+		m[labelTime] = r.Time
+	}
+	if r.UpdateTime != 0 {
+		m[labelUpdateTime] = r.UpdateTime
+	}
+
+	return m, nil
+}
+
+// Resolve resolves records of pack into measurements. it applies base fields and converts
+// relative times based on given now.
+func (p Pack) Resolve(now time.Time) ([]Measurement, error) {
+	var base Record
+
+	ms := make([]Measurement, 0, len(p))
+	for i, r := range p {
+		// base fields are applied until they are overridden
+		if r.BaseVersion != 0 {
+			if r.BaseVersion > Version {
+				return nil, fmt.Errorf("Record %d: version %d is not supported", i, r.BaseVersion)
+			}
+			base.BaseVersion = r.BaseVersion
+		}
+		if r.BaseName != "" {
+			base.BaseName = r.BaseName
+		}
+		if r.BaseTime != 0 {
+			base.BaseTime = r.BaseTime
+		}
+		if r.BaseUnit != "" {
+			base.BaseUnit = r.BaseUnit
+		}
+		if r.BaseValue != nil {
+			base.BaseValue = r.BaseValue
+		}
+		if r.BaseSum != nil {
+			base.BaseSum = r.BaseSum
+		}
+
+		m := Measurement{
+			Name:  base.BaseName + r.Name,
+			Asset: r.Name,
+			Unit:  r.Unit,
+		}
+		if m.Name == "" {
+			return nil, fmt.Errorf("Record %d: name must not be empty", i)
+		}
+		if m.Asset == "" {
+			m.Asset = m.Name
+		}
+		if m.Unit == "" {
+			m.Unit = base.BaseUnit
+		}
+
+		m.Time = resolveTime(base.BaseTime+r.Time, now)
+
+		n := 0
+		if r.Value != nil {
+			v := *r.Value
+			if base.BaseValue != nil {
+				v += *base.BaseValue
+			}
+			m.Value = v
+			n++
+		} else if base.BaseValue != nil && r.StringValue == nil && r.BoolValue == nil && r.DataValue == nil && r.Sum == nil {
+			m.Value = *base.BaseValue
+			n++
+		}
+		if r.StringValue != nil {
+			m.Value = *r.StringValue
+			n++
+		}
+		if r.BoolValue != nil {
+			m.Value = *r.BoolValue
+			n++
+		}
+		if r.DataValue != nil {
+			b, err := base64.RawURLEncoding.DecodeString(*r.DataValue)
+			if err != nil {
+				return nil, fmt.Errorf("Record %d: invalid data value: %s", i, err)
+			}
+			m.Value = b
+			n++
+		}
+		if n > 1 {
+			return nil, fmt.Errorf("Record %d: has more than one value", i)
+		}
+
+		if r.Sum != nil {
+			s := *r.Sum
+			if base.BaseSum != nil {
+				s += *base.BaseSum
+			}
+			m.Sum = &s
+			// records with only sum use it as their value
+			if n == 0 {
+				m.Value = s
+			}
+		} else if n == 0 {
+			return nil, fmt.Errorf("Record %d: does not have any value or sum", i)
+		}
+
+		ms = append(ms, m)
+	}
+
+	return ms, nil
+}
+
+// resolveTime converts SenML time into absolute time, times before 2**28 are relative to now
+func resolveTime(t float64, now time.Time) time.Time {
+	if t < relativeTime {
+		return now.Add(time.Duration(t * float64(time.Second)))
+	}
+
+	sec, frac := math.Modf(t)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second)))
+}
+
+// States resolves records of pack into states of given thing.
+// each record asset is its name without base name. states have no unit so SenML units
+// are dropped here and packs that are rendered from states have no units either.
+func (p Pack) States(thingID string, project string, now time.Time) ([]types.State, error) {
+	ms, err := p.Resolve(now)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := make([]types.State, 0, len(ms))
+	for _, m := range ms {
+		ss = append(ss, types.State{
+			Raw:     m.Value,
+			At:      m.Time,
+			ThingID: thingID,
+			Project: project,
+			Asset:   m.Asset,
+		})
+	}
+	return ss, nil
+}
+
+// FromStates renders given states as a pack. records of each thing share
+// the thing identification as their base name.
+func FromStates(ss []types.State) Pack {
+	p := make(Pack, 0, len(ss))
+
+	var thingID string
+	for i, s := range ss {
+		r := Record{
+			Name: s.Asset,
+			Time: float64(s.At.UnixNano()) / float64(time.Second),
+		}
+		if i == 0 || s.ThingID != thingID {
+			thingID = s.ThingID
+			r.BaseName = fmt.Sprintf("%s:", thingID)
+		}
+
+		switch {
+		case s.Value.String != "":
+			v := s.Value.String
+			r.StringValue = &v
+		case s.Value.Number != 0:
+			v := s.Value.Number
+			r.Value = &v
+		case s.Value.Boolean:
+			v := true
+			r.BoolValue = &v
+		default:
+			switch raw := s.Raw.(type) {
+			case bool:
+				r.BoolValue = &raw
+			case []byte:
+				v := base64.RawURLEncoding.EncodeToString(raw)
+				r.DataValue = &v
+			default:
+				v := s.Value.Number
+				r.Value = &v
+			}
+		}
+
+		p = append(p, r)
+	}
+
+	return p
+}
+
+// number converts CBOR numbers into float64
+func number(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case uint64:
+		return float64(n), nil
+	default:
+		return 0, fmt.Errorf("invalid number %v", v)
+	}
+}
+
+// numberRef converts CBOR numbers into float64 reference
+func numberRef(v interface{}) (*float64, error) {
+	n, err := number(v)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// text converts CBOR text strings into string
+func text(v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid text %v", v)
+	}
+	return s, nil
+}
@@ -0,0 +1,114 @@
+/*
+ *
+ * In The Name of God
+ *
+ * +===============================================
+ * | Author:        Parham Alvani <parham.alvani@gmail.com>
+ * |
+ * | Creation Date: 18-10-2026
+ * |
+ * | File Name:     senml_test.go
+ * +===============================================
+ */
+
+package senml
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FANIoT/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	p, err := DecodeJSON([]byte(`[
+		{"bn": "urn:dev:ow:10e2073a01080063:", "bt": 1.320067464e+09, "bu": "%RH", "v": 20, "n": "humidity"},
+		{"u": "lon", "v": 24.30621, "n": "longitude"},
+		{"n": "humidity", "t": 60, "v": 20.3},
+		{"n": "door", "vb": true},
+		{"n": "payload", "vd": "GCA"}
+	]`))
+	assert.NoError(t, err)
+
+	ms, err := p.Resolve(time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, ms, 5)
+
+	assert.Equal(t, "urn:dev:ow:10e2073a01080063:humidity", ms[0].Name)
+	assert.Equal(t, "humidity", ms[0].Asset)
+	assert.Equal(t, "%RH", ms[0].Unit)
+	assert.Equal(t, 20.0, ms[0].Value)
+	assert.Equal(t, time.Unix(1320067464, 0), ms[0].Time)
+
+	assert.Equal(t, "lon", ms[1].Unit)
+	assert.Equal(t, time.Unix(1320067524, 0), ms[2].Time)
+	assert.Equal(t, true, ms[3].Value)
+	assert.Equal(t, []byte{0x18, 0x20}, ms[4].Value)
+}
+
+func TestResolveRelative(t *testing.T) {
+	now := time.Now()
+
+	p, err := DecodeJSON([]byte(`[{"n": "temperature", "t": -10, "v": 18.20}]`))
+	assert.NoError(t, err)
+
+	ms, err := p.Resolve(now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-10*time.Second), ms[0].Time)
+}
+
+func TestResolveInvalid(t *testing.T) {
+	for _, b := range []string{
+		`[{"v": 18.20}]`,
+		`[{"n": "temperature"}]`,
+		`[{"n": "temperature", "v": 18.20, "vs": "18.20"}]`,
+		`[{"bver": 11, "n": "temperature", "v": 18.20}]`,
+	} {
+		p, err := DecodeJSON([]byte(b))
+		assert.NoError(t, err)
+
+		_, err = p.Resolve(time.Now())
+		assert.Error(t, err, b)
+	}
+}
+
+func TestCBOR(t *testing.T) {
+	v := 18.20
+	vs := "on"
+	p := Pack{
+		{BaseName: "0:", BaseTime: 1539858000, Name: "temperature", Unit: "Cel", Value: &v},
+		{Name: "light", Time: 60, StringValue: &vs},
+	}
+
+	b, err := EncodeCBOR(p)
+	assert.NoError(t, err)
+
+	d, err := DecodeCBOR(b)
+	assert.NoError(t, err)
+	assert.Equal(t, p, d)
+}
+
+func TestStates(t *testing.T) {
+	var s types.State
+	s.ThingID = "0"
+	s.Asset = "temperature"
+	s.At = time.Unix(1539858000, 0)
+	s.Raw = 18.20
+	s.Value.Number = 18.20
+
+	b, err := EncodeJSON(FromStates([]types.State{s}))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"bn": "0:", "n": "temperature", "t": 1539858000, "v": 18.20}]`, string(b))
+
+	p, err := DecodeJSON(b)
+	assert.NoError(t, err)
+
+	ss, err := p.States("0", "1", time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, ss, 1)
+	assert.Equal(t, "temperature", ss[0].Asset)
+	assert.Equal(t, "1", ss[0].Project)
+	assert.Equal(t, 18.20, ss[0].Raw)
+	assert.Equal(t, s.At, ss[0].At)
+}